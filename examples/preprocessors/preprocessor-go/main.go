@@ -5,47 +5,33 @@ import (
 	"log"
 	"strings"
 
-	"github.com/geocine/geopub/internal/preprocessor/runner"
-	"github.com/geocine/geopub/internal/preprocessor/sdk"
+	"github.com/geocine/geopub/pkg/preprocessor"
 )
 
 // Example preprocessor in Go
 // This demonstrates how to use the GeoPub preprocessor SDK.
-// It reads a preprocessor context, adds a note to each chapter, and writes it back.
+// It adds a reading time note to the beginning of each chapter.
 //
 // Usage in book.toml:
 // [preprocessor.go-example]
-// command = "go run examples/preprocessor-go/main.go"
+// command = "go run examples/preprocessors/preprocessor-go/main.go"
 // renderers = ["html"]
+// words-per-minute = 200
 
 func main() {
-	// Read the preprocessor context from stdin
-	ctx, err := sdk.ReadContext()
+	// Run reads the preprocessor context from stdin and writes it back to stdout.
+	// With `persistent = true` it handles every build of `geopub serve` in one process.
+	err := preprocessor.Run(preprocessor.Transform(addReadingTime))
 	if err != nil {
-		log.Fatalf("Failed to read context: %v", err)
-	}
-
-	if ctx.Book == nil || ctx.Book.Sections == nil {
-		log.Fatal("Invalid context: missing book or sections")
-	}
-
-	// Example: Add a note to the beginning of each chapter
-	for _, section := range ctx.Book.Sections {
-		if section.Chapter != nil {
-			section.Chapter.Content = addNoteToChapter(section.Chapter)
-		}
-	}
-
-	// Write the modified context back to stdout
-	if err := sdk.WriteContext(ctx); err != nil {
-		log.Fatalf("Failed to write context: %v", err)
+		log.Fatalf("Preprocessor failed: %v", err)
 	}
 }
 
-// addNoteToChapter adds a note to the beginning of chapter content
-func addNoteToChapter(ch *runner.JsonChapter) string {
-	if ch == nil {
-		return ""
+// addReadingTime adds a reading time note to the beginning of chapter content
+func addReadingTime(ctx *preprocessor.Context, ch *preprocessor.Chapter) (string, error) {
+	wordsPerMinute := preprocessor.ConfigFor(ctx, "go-example").GetInt("words-per-minute", 200)
+	if wordsPerMinute <= 0 {
+		return "", fmt.Errorf("words-per-minute must be positive, got %d", wordsPerMinute)
 	}
 
 	// Add a note at the top of the chapter
@@ -53,12 +39,12 @@ func addNoteToChapter(ch *runner.JsonChapter) string {
 
 	// Count words in the chapter (simple heuristic)
 	words := len(strings.Fields(ch.Content))
-	readingTime := (words + 199) / 200 // Assume 200 words per minute
+	readingTime := (words + wordsPerMinute - 1) / wordsPerMinute
 	if readingTime == 0 {
 		readingTime = 1
 	}
 
 	note += fmt.Sprintf("> **Reading time**: ~%d minute(s)\n\n", readingTime)
 
-	return note + ch.Content
+	return note + ch.Content, nil
 }
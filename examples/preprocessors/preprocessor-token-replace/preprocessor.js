@@ -15,6 +15,8 @@
  * command = "node preprocessors/token-replace/preprocessor.js"
  * AUTHOR_NAME = "Jane Doe"
  * VERSION = "1.0.0"
+ *
+ * Add `persistent = true` to keep it running across rebuilds of `geopub serve`.
  */
 
 const fs = require('fs');
@@ -48,7 +50,7 @@ function replaceTokens(content, config) {
   // Build regex from config keys
   for (const [key, value] of Object.entries(config)) {
     // Skip known non-token keys
-    if (['command', 'renderers', 'before', 'after'].includes(key)) {
+    if (['command', 'renderers', 'before', 'after', 'persistent'].includes(key)) {
       continue;
     }
     
@@ -78,40 +80,67 @@ function processChapter(chapter, config) {
   }
 }
 
+// Apply the preprocessor to a context and return it
+function processContext(context) {
+  if (!context.book || !context.book.sections) {
+    throw new Error('Invalid preprocessor context: missing book.sections');
+  }
+
+  // Build config dict from the preprocessor config
+  // Look for this preprocessor's config (can be named anything, just get first one)
+  const config = {};
+  if (context.config && context.config.preprocessor) {
+    // Get the first (or any) preprocessor config that isn't a known setting
+    for (const [name, cfg] of Object.entries(context.config.preprocessor)) {
+      // If it's an object with our settings, use it
+      if (typeof cfg === 'object' && cfg !== null) {
+        // This should be our preprocessor config
+        Object.assign(config, cfg);
+        break;
+      }
+    }
+  }
+
+  // Process all sections
+  for (const section of context.book.sections) {
+    if (section.chapter) {
+      processChapter(section.chapter, config);
+    }
+  }
+  return context;
+}
+
+// Persistent mode: one JSON request per line, one JSON response per line,
+// until GeoPub closes stdin
+function servePersistent() {
+  const rl = require('readline').createInterface({ input: process.stdin });
+  rl.on('line', (line) => {
+    let response;
+    try {
+      response = processContext(JSON.parse(line));
+    } catch (err) {
+      response = { error: err.message };
+    }
+    process.stdout.write(JSON.stringify(response) + '\n');
+  });
+}
+
 // Main preprocessor function
 async function main() {
+  // `preprocessor.js supports <renderer>`: every renderer is supported
+  if (process.argv[2] === 'supports') {
+    process.exit(0);
+  }
+  if (process.env.GEOPUB_PERSISTENT === '1') {
+    servePersistent();
+    return;
+  }
   try {
     // Read context from stdin
     const context = await readStdin();
-    
-    if (!context.book || !context.book.sections) {
-      throw new Error('Invalid preprocessor context: missing book.sections');
-    }
-    
-    // Build config dict from the preprocessor config
-    // Look for this preprocessor's config (can be named anything, just get first one)
-    const config = {};
-    if (context.config && context.config.preprocessor) {
-      // Get the first (or any) preprocessor config that isn't a known setting
-      for (const [name, cfg] of Object.entries(context.config.preprocessor)) {
-        // If it's an object with our settings, use it
-        if (typeof cfg === 'object' && cfg !== null) {
-          // This should be our preprocessor config
-          Object.assign(config, cfg);
-          break;
-        }
-      }
-    }
-    
-    // Process all sections
-    for (const section of context.book.sections) {
-      if (section.chapter) {
-        processChapter(section.chapter, config);
-      }
-    }
-    
+
     // Write result to stdout
-    process.stdout.write(JSON.stringify(context));
+    process.stdout.write(JSON.stringify(processContext(context)));
   } catch (err) {
     console.error(`Error: ${err.message}`);
     process.exit(1);
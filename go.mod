@@ -6,7 +6,10 @@ toolchain go1.24.5
 
 require github.com/pelletier/go-toml/v2 v2.0.6
 
-require github.com/yuin/goldmark v1.7.13
+require (
+	github.com/yuin/goldmark v1.7.13
+	golang.org/x/net v0.30.0
+)
 
 require gopkg.in/yaml.v2 v2.4.0 // indirect
 
@@ -15,5 +18,5 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.11.1
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -81,8 +81,8 @@ create-missing = %t
 		return err
 	}
 
-	// Create a .gitignore for the build dir
-	gitignore := []byte(fmt.Sprintf("%s\n", opts.BuildDir))
+	// Create a .gitignore for the build dir and the build cache
+	gitignore := []byte(fmt.Sprintf("%s\n.geopub-cache\n", opts.BuildDir))
 	_ = utils.WriteFile(filepath.Join(root, ".gitignore"), gitignore)
 
 	// Create a placeholder output directory (optional)
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -33,6 +35,7 @@ type BuildConfig struct {
 	BuildDir                string   `toml:"build-dir"`
 	CreateMissing           bool     `toml:"create-missing"`
 	ExtraWatchDirs          []string `toml:"extra-watch-dirs"`
+	WatchIgnore             []string `toml:"watch-ignore"` // Glob patterns that don't trigger a rebuild in serve
 	UseDefaultPreprocessors bool     `toml:"use-default-preprocessors"`
 }
 
@@ -42,6 +45,7 @@ func DefaultBuildConfig() BuildConfig {
 		BuildDir:                "book",
 		CreateMissing:           false,
 		ExtraWatchDirs:          []string{},
+		WatchIgnore:             []string{},
 		UseDefaultPreprocessors: true,
 	}
 }
@@ -338,6 +342,32 @@ func (c *Config) GetHtmlConfig() *HtmlConfig {
 	return &htmlCfg
 }
 
+// GetOutputNames returns the names of all configured [output.<name>] tables in sorted order
+// If no output table is configured, the html renderer is used
+func (c *Config) GetOutputNames() []string {
+	names := []string{}
+	for name, output := range c.Output {
+		if _, isMap := output.(map[string]interface{}); isMap {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{"html"}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetOutputConfig returns the raw [output.<name>] table, or an empty map if it is not configured
+func (c *Config) GetOutputConfig(name string) map[string]interface{} {
+	if output, ok := c.Output[name]; ok {
+		if m, isMap := output.(map[string]interface{}); isMap {
+			return m
+		}
+	}
+	return map[string]interface{}{}
+}
+
 // GetPreprocessorConfigs returns all configured preprocessors
 func (c *Config) GetPreprocessorConfigs() map[string]*PreprocessorConfig {
 	result := make(map[string]*PreprocessorConfig)
@@ -389,9 +419,37 @@ func (c *Config) GetPreprocessorConfigs() map[string]*PreprocessorConfig {
 				}
 			}
 
+			if persistent, ok := m["persistent"].(bool); ok {
+				pc.Persistent = persistent
+			}
+
+			switch timeout := m["timeout"].(type) {
+			case int64:
+				pc.Timeout = time.Duration(timeout) * time.Second
+			case float64:
+				pc.Timeout = time.Duration(timeout * float64(time.Second))
+			}
+
+			if env, ok := m["env"].(map[string]interface{}); ok {
+				pc.Env = make(map[string]string, len(env))
+				for k, v := range env {
+					pc.Env[k] = fmt.Sprint(v)
+				}
+			}
+
+			if cwd, ok := m["cwd"].(string); ok {
+				pc.Cwd = cwd
+			}
+
+			if check, ok := m["supports-check"].(bool); ok {
+				pc.SkipSupportsCheck = !check
+			}
+
 			// Store extra fields
 			for k, v := range m {
-				if k != "command" && k != "renderers" && k != "before" && k != "after" {
+				switch k {
+				case "command", "renderers", "before", "after", "persistent", "timeout", "env", "cwd", "supports-check":
+				default:
 					pc.Extra[k] = v
 				}
 			}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,6 +19,7 @@ src = "src"
 [build]
 build-dir = "out"
 create-missing = true
+watch-ignore = ["*.tmp", "src/drafts"]
 
 [output.html]
 theme = "light"
@@ -30,6 +32,7 @@ highlight = "highlight.js"
 	assert.Equal(t, "My Book", cfg.Book.Title)
 	assert.Equal(t, "out", cfg.Build.BuildDir)
 	assert.True(t, cfg.Build.CreateMissing)
+	assert.Equal(t, []string{"*.tmp", "src/drafts"}, cfg.Build.WatchIgnore)
 
 	// Html config projection
 	htmlCfg := cfg.GetHtmlConfig()
@@ -99,3 +102,61 @@ title = "Test"
 	assert.Equal(t, "navy", cfg.GetString("output.html.preferred-dark-theme", "navy"))
 	assert.Equal(t, "", cfg.GetString("output.html.git-repository-url", ""))
 }
+
+func TestGetOutputNames(t *testing.T) {
+	// No output tables defaults to html
+	cfg := NewDefaultConfig()
+	assert.Equal(t, []string{"html"}, cfg.GetOutputNames())
+
+	toml := `
+[book]
+title = "Test"
+
+[output.markdown]
+
+[output.html]
+default-theme = "rust"
+`
+	cfg, err := LoadFromString(toml)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"html", "markdown"}, cfg.GetOutputNames())
+	assert.Equal(t, "rust", cfg.GetOutputConfig("html")["default-theme"])
+	assert.Empty(t, cfg.GetOutputConfig("missing"))
+}
+
+func TestGetPreprocessorConfigs(t *testing.T) {
+	toml := `
+[book]
+title = "Test"
+
+[preprocessor.links]
+command = "node 'scripts/check links.js'"
+renderers = ["html"]
+timeout = 90
+cwd = "scripts"
+max-depth = 3
+
+[preprocessor.links.env]
+NODE_ENV = "production"
+RETRIES = 2
+
+[preprocessor.quick]
+timeout = 0.5
+`
+	cfg, err := LoadFromString(toml)
+	require.NoError(t, err)
+
+	pps := cfg.GetPreprocessorConfigs()
+	links := pps["links"]
+	require.NotNil(t, links)
+	assert.Equal(t, "node 'scripts/check links.js'", links.Command)
+	assert.Equal(t, []string{"html"}, links.Renderers)
+	assert.Equal(t, 90*time.Second, links.Timeout)
+	assert.Equal(t, "scripts", links.Cwd)
+	assert.Equal(t, map[string]string{"NODE_ENV": "production", "RETRIES": "2"}, links.Env)
+	assert.Equal(t, map[string]interface{}{"max-depth": int64(3)}, links.Extra)
+
+	assert.Equal(t, 500*time.Millisecond, pps["quick"].Timeout)
+	assert.Empty(t, pps["quick"].Env)
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // PreprocessorConfig holds configuration for a single preprocessor
 type PreprocessorConfig struct {
 	// Command is the executable to run for external preprocessors (optional)
@@ -16,6 +18,25 @@ type PreprocessorConfig struct {
 	// After is a list of preprocessor names that should run before this one
 	After []string `toml:"after"`
 
+	// Persistent keeps the preprocessor process running across builds and exchanges
+	// newline-delimited JSON with it instead of starting it for every build
+	Persistent bool `toml:"persistent"`
+
+	// Timeout bounds how long the preprocessor may take per build, set in seconds
+	// If zero, the default of 30 seconds applies
+	Timeout time.Duration `toml:"timeout"`
+
+	// Env holds extra environment variables for the preprocessor process
+	Env map[string]string `toml:"env"`
+
+	// Cwd is the directory the preprocessor runs in, relative to the book root
+	// If empty, it runs in the book root
+	Cwd string `toml:"cwd"`
+
+	// SkipSupportsCheck runs the preprocessor for every renderer without asking it
+	// through `<command> supports <renderer>` first; set by supports-check = false
+	SkipSupportsCheck bool `toml:"-"`
+
 	// Extra holds arbitrary extra configuration passed to the preprocessor
 	Extra map[string]interface{}
 }
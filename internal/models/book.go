@@ -48,6 +48,27 @@ func (b *Book) PushItem(item BookItem) {
 	b.Items = append(b.Items, item)
 }
 
+// Clone returns a deep copy of the book so each renderer can preprocess its own copy
+func (b *Book) Clone() *Book {
+	return &Book{Items: cloneItems(b.Items)}
+}
+
+// cloneItems deep-copies a list of book items
+func cloneItems(items []BookItem) []BookItem {
+	result := make([]BookItem, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Chapter:
+			result = append(result, v.Clone())
+		case *Separator:
+			result = append(result, &Separator{})
+		case *PartTitle:
+			result = append(result, &PartTitle{Title: v.Title})
+		}
+	}
+	return result
+}
+
 // Chapters returns only non-draft chapters from the book
 func (b *Book) Chapters() []*Chapter {
 	var chapters []*Chapter
@@ -99,6 +120,7 @@ type Chapter struct {
 	SourcePath  *string        // Actual path on disk
 	ParentNames []string       // Names of parent chapters
 	IsDraft     bool           // Is this a draft chapter?
+	Metadata    map[string]any // Frontmatter, parsed by the frontmatter preprocessor
 }
 
 // NewChapter creates a new chapter with content
@@ -129,6 +151,52 @@ func (c *Chapter) Type() BookItemType {
 	return ChapterItem
 }
 
+// Clone returns a deep copy of the chapter and its sub-items
+func (c *Chapter) Clone() *Chapter {
+	clone := &Chapter{
+		Name:        c.Name,
+		Content:     c.Content,
+		SubItems:    cloneItems(c.SubItems),
+		ParentNames: append([]string(nil), c.ParentNames...),
+		IsDraft:     c.IsDraft,
+	}
+	if c.Metadata != nil {
+		clone.Metadata = cloneValue(c.Metadata).(map[string]any)
+	}
+	if c.Number != nil {
+		clone.Number = &SectionNumber{Parts: append([]int(nil), c.Number.Parts...)}
+	}
+	if c.Path != nil {
+		path := *c.Path
+		clone.Path = &path
+	}
+	if c.SourcePath != nil {
+		sourcePath := *c.SourcePath
+		clone.SourcePath = &sourcePath
+	}
+	return clone
+}
+
+// cloneValue deep-copies the maps and slices of a decoded frontmatter value
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[k] = cloneValue(val)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, val := range v {
+			s[i] = cloneValue(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
 // IsDraftChapter returns true if this is a draft chapter
 func (c *Chapter) IsDraftChapter() bool {
 	return c.IsDraft
@@ -0,0 +1,418 @@
+// Package pdf writes simple PDF documents: text in the standard fonts, lines,
+// rectangles and raster images, internal and external links, and a bookmark outline.
+//
+// Coordinates are in points with the origin at the bottom-left corner of the page.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Page sizes in points
+const (
+	A4Width      = 595.28
+	A4Height     = 841.89
+	LetterWidth  = 612
+	LetterHeight = 792
+)
+
+// Document is a PDF document under construction
+type Document struct {
+	Title  string
+	Author string
+
+	width, height float64
+	pages         []*Page
+	bookmarks     []*bookmark
+	images        []*Image
+}
+
+// Page is a single page of a Document
+type Page struct {
+	content bytes.Buffer
+	links   []link
+}
+
+// Dest is a position in the document that links and bookmarks point to
+type Dest struct {
+	Page *Page
+	Y    float64
+}
+
+// link is a clickable area on a page, pointing either to a Dest or to a URI
+type link struct {
+	x, y, w, h float64
+	dest       Dest
+	uri        string
+}
+
+// bookmark is an entry in the document outline
+type bookmark struct {
+	title    string
+	level    int
+	dest     Dest
+	parent   *bookmark
+	children []*bookmark
+}
+
+// New creates an empty document with the given page size
+func New(width, height float64) *Document {
+	return &Document{width: width, height: height}
+}
+
+// Size returns the page width and height
+func (d *Document) Size() (float64, float64) {
+	return d.width, d.height
+}
+
+// AddPage appends a new page
+func (d *Document) AddPage() *Page {
+	return d.InsertPage(len(d.pages))
+}
+
+// InsertPage inserts a new page at index i
+func (d *Document) InsertPage(i int) *Page {
+	p := &Page{}
+	d.pages = append(d.pages, nil)
+	copy(d.pages[i+1:], d.pages[i:])
+	d.pages[i] = p
+	return p
+}
+
+// PageCount returns the number of pages
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// Pages returns the pages in document order
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// PageNumber returns the 1-based number of p, or 0 if p is not in the document
+func (d *Document) PageNumber(p *Page) int {
+	for i, page := range d.pages {
+		if page == p {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// AddBookmark adds an outline entry. Entries nest under the closest preceding entry
+// with a lower level.
+func (d *Document) AddBookmark(title string, level int, dest Dest) {
+	d.bookmarks = append(d.bookmarks, &bookmark{title: title, level: level, dest: dest})
+}
+
+// SetFillColor sets the color used for text and filled rectangles
+func (p *Page) SetFillColor(r, g, b float64) {
+	fmt.Fprintf(&p.content, "%s %s %s rg\n", num(r), num(g), num(b))
+}
+
+// SetStrokeColor sets the color used for lines and rectangle outlines
+func (p *Page) SetStrokeColor(r, g, b float64) {
+	fmt.Fprintf(&p.content, "%s %s %s RG\n", num(r), num(g), num(b))
+}
+
+// Text draws s with its baseline starting at (x, y)
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td %s Tj ET\n", int(font)+1, num(size), num(x), num(y), literal(encode(s)))
+}
+
+// Line draws a straight line
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n", num(width), num(x1), num(y1), num(x2), num(y2))
+}
+
+// Rect draws a rectangle with its lower-left corner at (x, y), filled or outlined
+func (p *Page) Rect(x, y, w, h float64, fill bool) {
+	op := "S"
+	if fill {
+		op = "f"
+	}
+	fmt.Fprintf(&p.content, "%s %s %s %s re %s\n", num(x), num(y), num(w), num(h), op)
+}
+
+// LinkToDest makes the rectangle at (x, y) a link to a position in the document
+func (p *Page) LinkToDest(x, y, w, h float64, dest Dest) {
+	p.links = append(p.links, link{x: x, y: y, w: w, h: h, dest: dest})
+}
+
+// LinkToURI makes the rectangle at (x, y) a link to an external URI
+func (p *Page) LinkToURI(x, y, w, h float64, uri string) {
+	p.links = append(p.links, link{x: x, y: y, w: w, h: h, uri: uri})
+}
+
+// Write serializes the document as PDF
+func (d *Document) Write(w io.Writer) error {
+	pw := &pdfWriter{w: w}
+
+	// Object numbers: catalog, page tree, fonts, info, images and their masks, then
+	// pages and their content streams, then link annotations and bookmarks
+	const catalogObj, pagesObj, fontsObj = 1, 2, 3
+	infoObj := fontsObj + len(baseFonts)
+	next := infoObj + 1
+
+	imageObjs := make([]int, len(d.images))
+	for i, img := range d.images {
+		imageObjs[i] = next
+		next++
+		if img.smask != nil {
+			next++
+		}
+	}
+
+	pageObjs := map[*Page]int{}
+	for _, p := range d.pages {
+		pageObjs[p] = next
+		next += 2
+	}
+	annotObjs := make([][]int, len(d.pages))
+	for i, p := range d.pages {
+		for range p.links {
+			annotObjs[i] = append(annotObjs[i], next)
+			next++
+		}
+	}
+	roots := d.outlineTree()
+	outlineObjs := map[*bookmark]int{}
+	outlinesObj := 0
+	if len(d.bookmarks) > 0 {
+		outlinesObj = next
+		next++
+		for _, bm := range d.bookmarks {
+			outlineObjs[bm] = next
+			next++
+		}
+	}
+
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R", pagesObj)
+	if outlinesObj != 0 {
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlinesObj)
+	}
+	pw.object(catalogObj, catalog+" >>")
+
+	kids := make([]string, len(d.pages))
+	for i, p := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObjs[p])
+	}
+	pw.object(pagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var fontRefs []string
+	for i, name := range baseFonts {
+		pw.object(fontsObj+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fontRefs = append(fontRefs, fmt.Sprintf("/F%d %d 0 R", i+1, fontsObj+i))
+	}
+	resources := fmt.Sprintf("<< /Font << %s >>", strings.Join(fontRefs, " "))
+	if len(d.images) > 0 {
+		var imageRefs []string
+		for i, img := range d.images {
+			imageRefs = append(imageRefs, fmt.Sprintf("/%s %d 0 R", img.name, imageObjs[i]))
+		}
+		resources += fmt.Sprintf(" /XObject << %s >>", strings.Join(imageRefs, " "))
+	}
+	resources += " >>"
+
+	pw.object(infoObj, fmt.Sprintf("<< /Title %s /Author %s /Producer (geopub) >>", textString(d.Title), textString(d.Author)))
+
+	for i, img := range d.images {
+		dict := "/Type /XObject /Subtype /Image " + img.dict
+		if img.smask != nil {
+			dict += fmt.Sprintf(" /SMask %d 0 R", imageObjs[i]+1)
+		}
+		pw.stream(imageObjs[i], dict, img.data)
+		if img.smask != nil {
+			pw.stream(imageObjs[i]+1, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+				img.Width, img.Height), img.smask)
+		}
+	}
+
+	for i, p := range d.pages {
+		page := fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R",
+			pagesObj, num(d.width), num(d.height), resources, pageObjs[p]+1)
+		if len(annotObjs[i]) > 0 {
+			refs := make([]string, len(annotObjs[i]))
+			for j, obj := range annotObjs[i] {
+				refs[j] = fmt.Sprintf("%d 0 R", obj)
+			}
+			page += fmt.Sprintf(" /Annots [%s]", strings.Join(refs, " "))
+		}
+		pw.object(pageObjs[p], page+" >>")
+
+		compressed, err := deflate(p.content.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to compress page %d: %w", i+1, err)
+		}
+		pw.stream(pageObjs[p]+1, "/Filter /FlateDecode", compressed)
+	}
+
+	for i, p := range d.pages {
+		for j, l := range p.links {
+			annot := fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%s %s %s %s] /Border [0 0 0]",
+				num(l.x), num(l.y), num(l.x+l.w), num(l.y+l.h))
+			if l.uri != "" {
+				annot += fmt.Sprintf(" /A << /S /URI /URI %s >>", literal([]byte(l.uri)))
+			} else {
+				annot += " /Dest " + d.destArray(l.dest, pageObjs)
+			}
+			pw.object(annotObjs[i][j], annot+" >>")
+		}
+	}
+
+	if outlinesObj != 0 {
+		pw.object(outlinesObj, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+			outlineObjs[roots[0]], outlineObjs[roots[len(roots)-1]], len(d.bookmarks)))
+		d.writeOutlineLevel(pw, roots, outlinesObj, outlineObjs, pageObjs)
+	}
+
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", next)
+	for obj := 1; obj < next; obj++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[obj])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", next, catalogObj, infoObj, xref)
+	return pw.err
+}
+
+// outlineTree links bookmarks into a tree by level and returns the top-level entries
+func (d *Document) outlineTree() []*bookmark {
+	var roots, stack []*bookmark
+	for _, bm := range d.bookmarks {
+		bm.parent, bm.children = nil, nil
+		for len(stack) > 0 && stack[len(stack)-1].level >= bm.level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, bm)
+		} else {
+			bm.parent = stack[len(stack)-1]
+			bm.parent.children = append(bm.parent.children, bm)
+		}
+		stack = append(stack, bm)
+	}
+	return roots
+}
+
+// writeOutlineLevel writes a list of sibling bookmarks and, recursively, their children
+func (d *Document) writeOutlineLevel(pw *pdfWriter, items []*bookmark, parentObj int, objs map[*bookmark]int, pageObjs map[*Page]int) {
+	for i, bm := range items {
+		entry := fmt.Sprintf("<< /Title %s /Parent %d 0 R /Dest %s", textString(bm.title), parentObj, d.destArray(bm.dest, pageObjs))
+		if i > 0 {
+			entry += fmt.Sprintf(" /Prev %d 0 R", objs[items[i-1]])
+		}
+		if i < len(items)-1 {
+			entry += fmt.Sprintf(" /Next %d 0 R", objs[items[i+1]])
+		}
+		if len(bm.children) > 0 {
+			entry += fmt.Sprintf(" /First %d 0 R /Last %d 0 R /Count %d",
+				objs[bm.children[0]], objs[bm.children[len(bm.children)-1]], countDescendants(bm))
+		}
+		pw.object(objs[bm], entry+" >>")
+		d.writeOutlineLevel(pw, bm.children, objs[bm], objs, pageObjs)
+	}
+}
+
+// countDescendants returns the number of entries below bm
+func countDescendants(bm *bookmark) int {
+	n := len(bm.children)
+	for _, c := range bm.children {
+		n += countDescendants(c)
+	}
+	return n
+}
+
+// destArray returns an explicit destination; positions on pages not in the document
+// fall back to the first page
+func (d *Document) destArray(dest Dest, pageObjs map[*Page]int) string {
+	obj, ok := pageObjs[dest.Page]
+	if !ok && len(d.pages) > 0 {
+		obj = pageObjs[d.pages[0]]
+	}
+	return fmt.Sprintf("[%d 0 R /XYZ null %s null]", obj, num(dest.Y))
+}
+
+// pdfWriter tracks byte offsets of objects for the cross-reference table
+type pdfWriter struct {
+	w       io.Writer
+	n       int
+	err     error
+	offsets map[int]int
+}
+
+func (pw *pdfWriter) printf(format string, args ...interface{}) {
+	pw.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (pw *pdfWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += n
+	pw.err = err
+}
+
+func (pw *pdfWriter) object(obj int, body string) {
+	if pw.offsets == nil {
+		pw.offsets = map[int]int{}
+	}
+	pw.offsets[obj] = pw.n
+	pw.printf("%d 0 obj\n%s\nendobj\n", obj, body)
+}
+
+func (pw *pdfWriter) stream(obj int, dict string, data []byte) {
+	if pw.offsets == nil {
+		pw.offsets = map[int]int{}
+	}
+	pw.offsets[obj] = pw.n
+	pw.printf("%d 0 obj\n<< /Length %d %s >>\nstream\n", obj, len(data), dict)
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// num formats a coordinate with at most two decimals
+func num(f float64) string {
+	s := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// literal returns a PDF literal string for raw bytes
+func literal(b []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// textString encodes a document text string (titles, metadata) as UTF-16BE so any
+// character survives
+func textString(s string) string {
+	b := []byte{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return literal(b)
+}
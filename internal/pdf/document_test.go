@@ -0,0 +1,119 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCrossReferences(t *testing.T) {
+	d := New(A4Width, A4Height)
+	d.Title = "Tïtle"
+	p1 := d.AddPage()
+	p1.Text(56, 700, Regular, 11, "Hello (world)")
+	p2 := d.AddPage()
+	p1.LinkToDest(56, 700, 100, 12, Dest{Page: p2, Y: 800})
+	p2.LinkToURI(56, 700, 100, 12, "https://example.com")
+
+	var buf bytes.Buffer
+	require.NoError(t, d.Write(&buf))
+	data := buf.Bytes()
+
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	require.NotNil(t, m)
+	xref, _ := strconv.Atoi(string(m[1]))
+	require.True(t, bytes.HasPrefix(data[xref:], []byte("xref\n0 ")))
+
+	// Every entry in the cross-reference table must point at its object
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	require.NotEmpty(t, entries)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		assert.True(t, bytes.HasPrefix(data[off:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+
+	assert.Contains(t, string(data), "/Count 2 >>")
+	assert.Contains(t, string(data), "/URI (https://example.com)")
+	assert.Regexp(t, `/Dest \[\d+ 0 R /XYZ null 800 null\]`, string(data))
+	assert.NotContains(t, string(data), "/Outlines")
+}
+
+func TestOutlineTree(t *testing.T) {
+	d := New(LetterWidth, LetterHeight)
+	p := d.AddPage()
+	for _, bm := range []struct {
+		title string
+		level int
+	}{{"Part", 0}, {"One", 1}, {"Heading", 3}, {"Two", 1}, {"Other part", 0}} {
+		d.AddBookmark(bm.title, bm.level, Dest{Page: p})
+	}
+
+	roots := d.outlineTree()
+	require.Len(t, roots, 2)
+	assert.Equal(t, "Part", roots[0].title)
+	require.Len(t, roots[0].children, 2)
+	assert.Equal(t, "Heading", roots[0].children[0].children[0].title)
+	assert.Equal(t, 3, countDescendants(roots[0]))
+
+	var buf bytes.Buffer
+	require.NoError(t, d.Write(&buf))
+	assert.Contains(t, buf.String(), "/PageMode /UseOutlines")
+	assert.Contains(t, buf.String(), "/Type /Outlines")
+}
+
+func TestInsertPage(t *testing.T) {
+	d := New(A4Width, A4Height)
+	first := d.AddPage()
+	last := d.AddPage()
+	front := d.InsertPage(0)
+	assert.Equal(t, 1, d.PageNumber(front))
+	assert.Equal(t, 2, d.PageNumber(first))
+	assert.Equal(t, 3, d.PageNumber(last))
+	assert.Equal(t, 0, d.PageNumber(&Page{}))
+}
+
+func TestEncodeAndTextWidth(t *testing.T) {
+	assert.Equal(t, []byte("caf\xe9 \x93q\x94 \x97 ?"), encode("café “q” — 漢"))
+	assert.Equal(t, `(a\(b\)\\)`, literal([]byte(`a(b)\`)))
+	assert.InDelta(t, 6.0, TextWidth(Mono, 10, "a"), 0.001)
+	assert.InDelta(t, 5.56, TextWidth(Regular, 10, "a"), 0.001)
+	assert.InDelta(t, 6.11, TextWidth(Bold, 10, "b"), 0.001)
+}
+
+func TestAddImage(t *testing.T) {
+	var buf bytes.Buffer
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	require.NoError(t, png.Encode(&buf, src))
+
+	d := New(A4Width, A4Height)
+	img, err := d.AddImage(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 3, img.Width)
+	assert.Equal(t, 2, img.Height)
+	d.AddPage().Image(img, 10, 20, 30, 20)
+
+	_, err = d.AddImage([]byte("<svg/>"))
+	assert.Error(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, d.Write(&out))
+	s := out.String()
+	assert.Contains(t, s, "/XObject << /Im1 ")
+	assert.Contains(t, s, "/Subtype /Image /Width 3 /Height 2 /ColorSpace /DeviceRGB")
+	assert.Contains(t, s, "/SMask ")
+}
+
+func TestUnsupported(t *testing.T) {
+	assert.Empty(t, Unsupported("Café – “quoted”\n"))
+	assert.Equal(t, []rune{'П', 'р', '🙂'}, Unsupported("Пр Пр 🙂"))
+}
@@ -0,0 +1,126 @@
+package pdf
+
+// Font selects one of the standard Type 1 fonts every PDF viewer provides, so no font
+// data has to be embedded
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+	Italic
+	BoldItalic
+	Mono
+)
+
+// baseFonts are the PostScript names of the standard fonts, indexed by Font
+var baseFonts = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier"}
+
+// helveticaWidths are the Helvetica glyph widths for codes 32-126, in 1/1000 em
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// helveticaBoldWidths are the Helvetica-Bold glyph widths for codes 32-126, in 1/1000 em
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// highWidths covers the common WinAnsi codes above 126; other codes use the width of a digit
+var highWidths = map[byte][2]int{
+	0x85: {1000, 1000}, // ellipsis
+	0x91: {222, 278},   // quoteleft
+	0x92: {222, 278},   // quoteright
+	0x93: {333, 500},   // quotedblleft
+	0x94: {333, 500},   // quotedblright
+	0x95: {350, 350},   // bullet
+	0x96: {556, 556},   // endash
+	0x97: {1000, 1000}, // emdash
+	0xA0: {278, 278},   // nbsp
+}
+
+// winAnsiHigh maps the Unicode characters of WinAnsiEncoding's 0x80-0x9F range
+var winAnsiHigh = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// encode converts a UTF-8 string to WinAnsiEncoding, replacing unsupported characters with '?'
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if b, ok := winAnsi(r); ok {
+			out = append(out, b)
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// winAnsi returns the WinAnsiEncoding code of r, if the standard fonts have a glyph for it
+func winAnsi(r rune) (byte, bool) {
+	switch {
+	case r == '\t':
+		return ' ', true
+	case r >= 32 && r <= 126, r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	b, ok := winAnsiHigh[r]
+	return b, ok
+}
+
+// Unsupported returns the distinct characters of s that the standard fonts can't show.
+// Text drawn with them shows '?' in their place.
+func Unsupported(s string) []rune {
+	var missing []rune
+	seen := map[rune]bool{}
+	for _, r := range s {
+		if _, ok := winAnsi(r); !ok && r != '\n' && !seen[r] {
+			seen[r] = true
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// TextWidth returns the width of s in points when set in font at size
+func TextWidth(font Font, size float64, s string) float64 {
+	total := 0
+	for _, c := range encode(s) {
+		total += glyphWidth(font, c)
+	}
+	return float64(total) * size / 1000
+}
+
+// glyphWidth returns the width of a WinAnsi code in 1/1000 em
+func glyphWidth(font Font, c byte) int {
+	if font == Mono {
+		return 600
+	}
+	bold := font == Bold || font == BoldItalic
+	if c >= 32 && c <= 126 {
+		if bold {
+			return helveticaBoldWidths[c-32]
+		}
+		return helveticaWidths[c-32]
+	}
+	if w, ok := highWidths[c]; ok {
+		if bold {
+			return w[1]
+		}
+		return w[0]
+	}
+	return 556
+}
@@ -0,0 +1,100 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register decoders for the formats books commonly embed
+	"image/jpeg"
+	_ "image/png"
+)
+
+// Image is a raster image embedded once and drawn on any number of pages
+type Image struct {
+	Width, Height int // Size in pixels
+
+	name  string // Resource name, e.g. Im1
+	dict  string // Stream dictionary entries besides /Length
+	data  []byte
+	smask []byte // Compressed alpha channel, if the image has transparency
+}
+
+// AddImage embeds a JPEG, PNG or GIF image. Baseline JPEGs are embedded as they are;
+// other images are decoded and stored losslessly.
+func (d *Document) AddImage(data []byte) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	img := &Image{Width: cfg.Width, Height: cfg.Height, name: fmt.Sprintf("Im%d", len(d.images)+1)}
+	switch {
+	case format == "jpeg" && cfg.ColorModel == color.YCbCrModel:
+		img.dict = fmt.Sprintf("/Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", cfg.Width, cfg.Height)
+		img.data = data
+	case format == "jpeg" && cfg.ColorModel == color.GrayModel:
+		img.dict = fmt.Sprintf("/Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode", cfg.Width, cfg.Height)
+		img.data = data
+	default:
+		var decoded image.Image
+		if format == "jpeg" {
+			decoded, err = jpeg.Decode(bytes.NewReader(data))
+		} else {
+			decoded, _, err = image.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s image: %w", format, err)
+		}
+		if err := img.setPixels(decoded); err != nil {
+			return nil, err
+		}
+	}
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// setPixels stores decoded pixels as compressed RGB samples and an alpha mask
+func (img *Image) setPixels(src image.Image) error {
+	b := src.Bounds()
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xFF
+		}
+	}
+	var err error
+	if img.data, err = deflate(rgb); err != nil {
+		return err
+	}
+	img.dict = fmt.Sprintf("/Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode", b.Dx(), b.Dy())
+	if !opaque {
+		if img.smask, err = deflate(alpha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Image draws img scaled to w×h points with its lower-left corner at (x, y)
+func (p *Page) Image(img *Image, x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /%s Do Q\n", num(w), num(h), num(x), num(y), img.name)
+}
+
+// deflate compresses data for a /FlateDecode stream
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,12 +1,17 @@
 package frontmatter
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/geocine/geopub/internal/models"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-// FrontmatterPreprocessor strips YAML/TOML frontmatter from chapters
+// FrontmatterPreprocessor parses YAML/TOML frontmatter into Chapter.Metadata and strips
+// it from the content. A "title" replaces the chapter name from SUMMARY.md, and a chapter
+// with "draft: true" is left out of the book together with its sub-chapters.
 // This preprocessor is DISABLED BY DEFAULT
 // Users must explicitly enable it in book.toml:
 //
@@ -24,46 +29,103 @@ func (f *FrontmatterPreprocessor) Name() string {
 	return "frontmatter"
 }
 
-// Process strips frontmatter from all chapters
+// Process parses and strips frontmatter from all chapters
 func (f *FrontmatterPreprocessor) Process(book *models.Book) error {
-	for _, item := range book.Items {
-		if ch, ok := item.(*models.Chapter); ok {
-			ch.Content = stripFrontmatter(ch.Content)
-			// Recursively process sub-chapters
-			f.processSubItems(ch.SubItems)
-		}
+	items, err := f.processItems(book.Items)
+	if err != nil {
+		return err
 	}
+	book.Items = items
 	return nil
 }
 
-// processSubItems recursively strips frontmatter from sub-items
-func (f *FrontmatterPreprocessor) processSubItems(items []models.BookItem) {
+// processItems handles the frontmatter of items and their sub-items, returning the
+// items without the drafts
+func (f *FrontmatterPreprocessor) processItems(items []models.BookItem) ([]models.BookItem, error) {
+	result := make([]models.BookItem, 0, len(items))
 	for _, item := range items {
-		if ch, ok := item.(*models.Chapter); ok {
-			ch.Content = stripFrontmatter(ch.Content)
-			f.processSubItems(ch.SubItems)
+		ch, ok := item.(*models.Chapter)
+		if !ok {
+			result = append(result, item)
+			continue
+		}
+
+		format, data, content := splitFrontmatter(ch.Content)
+		if format != "" {
+			metadata, err := parseFrontmatter(format, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse frontmatter of '%s': %w", ch.Name, err)
+			}
+			ch.Content = content
+			if len(metadata) > 0 {
+				ch.Metadata = metadata
+			}
+		}
+
+		if draft, _ := ch.Metadata["draft"].(bool); draft {
+			continue
+		}
+		if title, _ := ch.Metadata["title"].(string); title != "" {
+			ch.Name = title
 		}
+
+		subItems, err := f.processItems(ch.SubItems)
+		if err != nil {
+			return nil, err
+		}
+		ch.SubItems = subItems
+		result = append(result, ch)
 	}
+	return result, nil
 }
 
-// stripFrontmatter removes YAML or TOML frontmatter from content
 // Frontmatter formats:
 // - YAML: between --- delimiters
 // - TOML: between +++ delimiters
 // - Must be at the very start of the content
-func stripFrontmatter(content string) string {
-	// YAML frontmatter: --- ... --- (content can be empty)
-	yamlPattern := regexp.MustCompile(`(?s)^---\s*\n(.*?)\n---\s*\n`)
-	if yamlPattern.MatchString(content) {
-		return yamlPattern.ReplaceAllString(content, "")
+// - May be empty, and the closing delimiter may be the last line of the file
+var (
+	yamlPattern = regexp.MustCompile(`(?s)^---\s*\n(?:(.*?)\n)?---\s*(?:\n|$)`)
+	tomlPattern = regexp.MustCompile(`(?s)^\+\+\+\s*\n(?:(.*?)\n)?\+\+\+\s*(?:\n|$)`)
+)
+
+// splitFrontmatter separates frontmatter from content. It returns the format ("yaml",
+// "toml" or "" when there is none), the frontmatter and the content without it.
+func splitFrontmatter(content string) (format, data, rest string) {
+	if m := yamlPattern.FindStringSubmatchIndex(content); m != nil {
+		return "yaml", frontmatterBody(content, m), content[m[1]:]
+	}
+	if m := tomlPattern.FindStringSubmatchIndex(content); m != nil {
+		return "toml", frontmatterBody(content, m), content[m[1]:]
 	}
+	return "", "", content
+}
 
-	// TOML frontmatter: +++ ... +++ (content can be empty)
-	tomlPattern := regexp.MustCompile(`(?s)^\+\+\+\s*\n(.*?)\n\+\+\+\s*\n`)
-	if tomlPattern.MatchString(content) {
-		return tomlPattern.ReplaceAllString(content, "")
+// frontmatterBody returns the text between the delimiters of a match, empty if there is none
+func frontmatterBody(content string, m []int) string {
+	if m[2] < 0 {
+		return ""
 	}
+	return content[m[2]:m[3]]
+}
+
+// stripFrontmatter removes YAML or TOML frontmatter from content
+func stripFrontmatter(content string) string {
+	_, _, rest := splitFrontmatter(content)
+	return rest
+}
 
-	// No frontmatter found
-	return content
+// parseFrontmatter decodes frontmatter in the given format
+func parseFrontmatter(format, data string) (map[string]any, error) {
+	metadata := map[string]any{}
+	var err error
+	if format == "toml" {
+		err = toml.Unmarshal([]byte(data), &metadata)
+	} else {
+		err = yaml.Unmarshal([]byte(data), &metadata)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
 }
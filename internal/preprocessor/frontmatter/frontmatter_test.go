@@ -1,6 +1,8 @@
 package frontmatter
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/geocine/geopub/internal/models"
@@ -63,6 +65,38 @@ Content.`,
 
 Content.`,
 		},
+		{
+			name: "Frontmatter without a body",
+			input: `---
+---
+
+# Chapter
+
+Content.`,
+			expected: `# Chapter
+
+Content.`,
+		},
+		{
+			name:     "TOML frontmatter without a body",
+			input:    "+++\n+++\n# Chapter",
+			expected: "# Chapter",
+		},
+		{
+			name:     "Closing delimiter on the last line",
+			input:    "---\ntitle: Only metadata\n---",
+			expected: "",
+		},
+		{
+			name:     "TOML closing delimiter on the last line",
+			input:    "+++\ntitle = \"Only metadata\"\n+++",
+			expected: "",
+		},
+		{
+			name:     "Empty frontmatter on the last line",
+			input:    "---\n---",
+			expected: "",
+		},
 		{
 			name: "Multiline YAML values",
 			input: `---
@@ -180,6 +214,111 @@ Child content`, "child.md", []string{"Parent"})
 	}
 }
 
+func TestFrontmatterMetadata(t *testing.T) {
+	yamlCh := models.NewChapter("From Summary", `---
+title: Custom Title
+description: About this page
+authors: [Ann, Bob]
+tags:
+  - go
+  - docs
+extra:
+  level: 2
+---
+
+# Content`, "yaml.md", []string{})
+
+	tomlCh := models.NewChapter("Toml", `+++
+description = "From TOML"
+tags = ["toml"]
++++
+
+# Content`, "toml.md", []string{})
+
+	book := models.NewBookWithItems([]models.BookItem{yamlCh, tomlCh})
+	if err := NewFrontmatterPreprocessor().Process(book); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	want := map[string]any{
+		"title":       "Custom Title",
+		"description": "About this page",
+		"authors":     []any{"Ann", "Bob"},
+		"tags":        []any{"go", "docs"},
+		"extra":       map[string]any{"level": 2},
+	}
+	if !reflect.DeepEqual(yamlCh.Metadata, want) {
+		t.Errorf("unexpected YAML metadata: %#v", yamlCh.Metadata)
+	}
+	if yamlCh.Name != "Custom Title" {
+		t.Errorf("title should replace the SUMMARY name, got %q", yamlCh.Name)
+	}
+	if yamlCh.Content != "# Content" {
+		t.Errorf("frontmatter not stripped: %q", yamlCh.Content)
+	}
+
+	if tomlCh.Metadata["description"] != "From TOML" || !reflect.DeepEqual(tomlCh.Metadata["tags"], []any{"toml"}) {
+		t.Errorf("unexpected TOML metadata: %#v", tomlCh.Metadata)
+	}
+	if tomlCh.Name != "Toml" {
+		t.Errorf("name should be kept without a title, got %q", tomlCh.Name)
+	}
+}
+
+func TestFrontmatterEmptyAndUnterminated(t *testing.T) {
+	empty := models.NewChapter("Empty", "---\n---\nText", "empty.md", []string{})
+	last := models.NewChapter("Last", "---\ntitle: Metadata Only\n---", "last.md", []string{})
+	book := models.NewBookWithItems([]models.BookItem{empty, last})
+	if err := NewFrontmatterPreprocessor().Process(book); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	if empty.Content != "Text" || len(empty.Metadata) != 0 {
+		t.Errorf("empty frontmatter not stripped: %q %#v", empty.Content, empty.Metadata)
+	}
+	if last.Content != "" || last.Name != "Metadata Only" {
+		t.Errorf("frontmatter closed on the last line not parsed: %q %q", last.Content, last.Name)
+	}
+}
+
+func TestFrontmatterDraftsAreExcluded(t *testing.T) {
+	draft := models.NewChapter("Draft", "---\ndraft: true\n---\n\nNot ready", "draft.md", []string{})
+	draft.SubItems = append(draft.SubItems, models.NewChapter("Under Draft", "Hidden", "under.md", []string{"Draft"}))
+	parent := models.NewChapter("Parent", "---\ndraft: false\n---\n\nParent", "parent.md", []string{})
+	parent.SubItems = append(parent.SubItems,
+		models.NewChapter("Nested Draft", "+++\ndraft = true\n+++\n\nNot ready", "nested.md", []string{"Parent"}),
+		models.NewChapter("Child", "Child", "child.md", []string{"Parent"}),
+	)
+	book := models.NewBookWithItems([]models.BookItem{draft, &models.Separator{}, parent})
+
+	if err := NewFrontmatterPreprocessor().Process(book); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	var names []string
+	for _, item := range book.IterAll() {
+		if ch, ok := item.(*models.Chapter); ok {
+			names = append(names, ch.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "Parent,Child" {
+		t.Errorf("drafts and their sub-chapters should be excluded, got %s", got)
+	}
+	if len(book.Items) != 2 {
+		t.Errorf("expected the separator and parent to remain, got %d items", len(book.Items))
+	}
+}
+
+func TestFrontmatterInvalid(t *testing.T) {
+	book := models.NewBookWithItems([]models.BookItem{
+		models.NewChapter("Broken", "---\ntitle: [unclosed\n---\n\nContent", "broken.md", []string{}),
+	})
+	err := NewFrontmatterPreprocessor().Process(book)
+	if err == nil || !strings.Contains(err.Error(), "'Broken'") {
+		t.Errorf("expected an error naming the chapter, got %v", err)
+	}
+}
+
 func TestFrontmatterPreprocessorName(t *testing.T) {
 	fp := NewFrontmatterPreprocessor()
 	if fp.Name() != "frontmatter" {
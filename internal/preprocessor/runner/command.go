@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SplitCommand splits a command line into arguments the way a POSIX shell would,
+// without expanding anything. Single quotes keep their content as is, double quotes
+// allow \" and \\, and outside quotes a backslash escapes a space or quote. Other
+// backslashes are kept, so Windows paths such as C:\tools\pp.exe work unquoted.
+func SplitCommand(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	runes := []rune(command)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexRune(string(runes[i+1:]), '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in command: %s", command)
+			}
+			quoted := string(runes[i+1:])[:end]
+			current.WriteString(quoted)
+			i += len([]rune(quoted)) + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				current.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated double quote in command: %s", command)
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(runes) && (unicode.IsSpace(runes[i+1]) || strings.ContainsRune(`'"\`, runes[i+1])):
+			i++
+			current.WriteRune(runes[i])
+			inWord = true
+		case unicode.IsSpace(c):
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// JoinCommand is the inverse of SplitCommand, quoting the arguments that need it
+func JoinCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsFunc(arg, func(r rune) bool {
+			return unicode.IsSpace(r) || strings.ContainsRune(`'"\`, r)
+		}) {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
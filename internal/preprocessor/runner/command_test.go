@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"node script.js", []string{"node", "script.js"}},
+		{"  node   script.js  ", []string{"node", "script.js"}},
+		{`node "my scripts/pp.js" --name 'a b'`, []string{"node", "my scripts/pp.js", "--name", "a b"}},
+		{`echo "say \"hi\"" 'it'\''s'`, []string{"echo", `say "hi"`, "it's"}},
+		{`run my\ file.js`, []string{"run", "my file.js"}},
+		{`C:\tools\pp.exe --flag`, []string{`C:\tools\pp.exe`, "--flag"}},
+		{`pp "" x`, []string{"pp", "", "x"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitCommand(tt.command)
+		if err != nil {
+			t.Errorf("SplitCommand(%q) error: %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+		if round, _ := SplitCommand(JoinCommand(got)); len(got) > 0 && !reflect.DeepEqual(round, got) {
+			t.Errorf("SplitCommand(JoinCommand(%q)) = %q", got, round)
+		}
+	}
+
+	for _, command := range []string{`node 'script.js`, `node "script.js`} {
+		if _, err := SplitCommand(command); err == nil {
+			t.Errorf("SplitCommand(%q) should fail", command)
+		}
+	}
+}
+
+func TestPrepareWorkingDirectory(t *testing.T) {
+	root := filepath.FromSlash("/books/my book")
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"node scripts/pp.js", []string{"node", filepath.Join(root, "scripts/pp.js")}},
+		{"./bin/pp --x", []string{filepath.Join(root, "bin/pp"), "--x"}},
+		{`node "my scripts/pp.js"`, []string{"node", filepath.Join(root, "my scripts/pp.js")}},
+		{"geopub-links", []string{"geopub-links"}},
+	}
+	for _, tt := range tests {
+		got, err := SplitCommand(PrepareWorkingDirectory(tt.command, root))
+		if err != nil {
+			t.Fatalf("SplitCommand() error: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PrepareWorkingDirectory(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,6 +16,10 @@ import (
 	"github.com/geocine/geopub/internal/models"
 )
 
+// defaultExternalTimeout bounds how long an external preprocessor may take per build
+// unless its config sets a timeout
+const defaultExternalTimeout = 30 * time.Second
+
 // ExternalPreprocessor represents an external preprocessor that runs as a separate command
 type ExternalPreprocessor struct {
 	Name       string
@@ -23,17 +28,93 @@ type ExternalPreprocessor struct {
 	Book       *models.Book
 	Config     *config.Config
 	Renderer   string
+	Root       string // Book root; empty means the working directory
+	Cwd        string // Directory the command runs in, relative to Root
+	Env        map[string]string
+	Timeout    time.Duration // Zero means defaultExternalTimeout
+	Persistent bool          // Keep the process running across builds, see PersistentEnv
+	Verbose    bool          // Stream stderr to the terminal as it is written
 	ExtraProps map[string]interface{}
+	// Supports caches the answers of the `supports` probe; nil probes every time
+	Supports *SupportsCache
+	// SkipSupportsCheck runs the preprocessor for every renderer without probing it
+	SkipSupportsCheck bool
 }
 
-// RunExternal executes an external preprocessor and returns the modified book
-func (ep *ExternalPreprocessor) RunExternal() error {
-	// Resolve command if not specified
-	command := ep.Command
-	if command == "" {
-		command = fmt.Sprintf("geopub-%s", ep.Name)
+// command returns the command line of the preprocessor, "geopub-<name>" by default
+func (ep *ExternalPreprocessor) command() string {
+	if ep.Command == "" {
+		return fmt.Sprintf("geopub-%s", ep.Name)
+	}
+	return ep.Command
+}
+
+// invocation describes how to start an external preprocessor
+type invocation struct {
+	args    []string // Program and arguments, with relative paths resolved against the book root
+	dir     string
+	env     []string // Added to the environment of GeoPub
+	timeout time.Duration
+}
+
+// key identifies the invocation in the caches of persistent processes and probes
+func (inv *invocation) key() string {
+	return inv.dir + "\x00" + strings.Join(inv.args, "\x00") + "\x00" + strings.Join(inv.env, "\x00")
+}
+
+// command creates the command for the invocation with the extra arguments appended
+func (inv *invocation) command(ctx context.Context, extra ...string) *exec.Cmd {
+	args := append(append([]string{}, inv.args[1:]...), extra...)
+	cmd := exec.CommandContext(ctx, inv.args[0], args...)
+	cmd.Dir = inv.dir
+	cmd.Env = append(os.Environ(), inv.env...)
+	return cmd
+}
+
+// invocation parses the command line and resolves the working directory, environment
+// and timeout of the preprocessor
+func (ep *ExternalPreprocessor) invocation() (*invocation, error) {
+	root, err := filepath.Abs(ep.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve book root: %w", err)
+	}
+	args, err := SplitCommand(PrepareWorkingDirectory(ep.command(), root))
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
 	}
 
+	dir := root
+	if ep.Cwd != "" {
+		dir = ep.Cwd
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+	}
+
+	keys := make([]string, 0, len(ep.Env))
+	for k := range ep.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+ep.Env[k])
+	}
+
+	timeout := ep.Timeout
+	if timeout <= 0 {
+		timeout = defaultExternalTimeout
+	}
+	return &invocation{args: args, dir: dir, env: env, timeout: timeout}, nil
+}
+
+// RunExternal executes an external preprocessor and returns the modified book. It
+// skips renderers the preprocessor isn't configured for or declines in its `supports`
+// check; Runner.Run does those checks itself and calls process directly.
+func (ep *ExternalPreprocessor) RunExternal() error {
 	// Check if preprocessor should run for this renderer
 	if len(ep.Renderers) > 0 {
 		found := false
@@ -49,10 +130,15 @@ func (ep *ExternalPreprocessor) RunExternal() error {
 		}
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Ask the preprocessor itself
+	if supported, err := ep.checkSupported(); err != nil || !supported {
+		return err
+	}
+	return ep.process()
+}
 
+// process sends the book to the preprocessor and applies the book it returns
+func (ep *ExternalPreprocessor) process() error {
 	// Create the preprocessor context
 	ppCtx := NewPreprocessorContext(ep.Book, ep.Config, ep.Renderer)
 
@@ -62,23 +148,37 @@ func (ep *ExternalPreprocessor) RunExternal() error {
 		return fmt.Errorf("failed to marshal preprocessor context: %w", err)
 	}
 
-	// Parse command (handle shell commands like "node script.js")
-	parts := strings.Fields(command)
-	var cmd *exec.Cmd
-	if len(parts) == 1 {
-		cmd = exec.CommandContext(ctx, parts[0])
-	} else {
-		cmd = exec.CommandContext(ctx, parts[0], parts[1:]...)
+	inv, err := ep.invocation()
+	if err != nil {
+		return fmt.Errorf("preprocessor '%s' failed: %w", ep.Name, err)
+	}
+
+	if ep.Persistent {
+		return ep.runPersistent(inv, inputJSON)
 	}
 
-	// Set up stdin, stdout, stderr
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), inv.timeout)
+	defer cancel()
+
+	cmd := inv.command(ctx)
+
+	// Set up stdin, stdout, stderr. In verbose mode stderr goes straight to the
+	// terminal, so progress shows up while the preprocessor runs.
 	var stdout, stderr bytes.Buffer
 	cmd.Stdin = bytes.NewReader(inputJSON)
 	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	if ep.Verbose {
+		cmd.Stderr = os.Stderr
+	} else {
+		cmd.Stderr = &stderr
+	}
 
 	// Execute
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("preprocessor '%s' timed out after %s", ep.Name, inv.timeout)
+		}
 		stderrMsg := stderr.String()
 		if stderrMsg != "" {
 			return fmt.Errorf("preprocessor '%s' failed: %w\nstderr: %s", ep.Name, err, stderrMsg)
@@ -100,6 +200,34 @@ func (ep *ExternalPreprocessor) RunExternal() error {
 	return nil
 }
 
+// runPersistent sends the context to the long-running process of the preprocessor,
+// starting it if needed, and applies the book it answers with. Failures include what
+// the process wrote to stderr during the request, like those of one-shot runs.
+func (ep *ExternalPreprocessor) runPersistent(inv *invocation, inputJSON []byte) error {
+	proc := persistentProcessFor(inv)
+	output, stderr, err := proc.request(inputJSON, inv.timeout, ep.Verbose)
+	if err != nil {
+		return withStderr(fmt.Errorf("preprocessor '%s' failed: %w", ep.Name, err), stderr)
+	}
+	outputCtx, err := decodePersistentResponse(output)
+	if err != nil {
+		err = fmt.Errorf("preprocessor '%s' returned invalid response: %w\noutput: %s", ep.Name, err, output)
+		return withStderr(err, proc.settledStderr())
+	}
+	if err := JsonToBook(outputCtx.Book, ep.Book); err != nil {
+		return fmt.Errorf("failed to apply preprocessor mutations: %w", err)
+	}
+	return nil
+}
+
+// withStderr appends the stderr output of a failed preprocessor to err
+func withStderr(err error, stderr string) error {
+	if stderr == "" {
+		return err
+	}
+	return fmt.Errorf("%w\nstderr: %s", err, stderr)
+}
+
 // ResolveCommand resolves the command for a preprocessor
 // If command is specified, uses it as-is (may contain spaces for shell commands)
 // Otherwise, resolves to "geopub-<name>" on PATH
@@ -122,12 +250,15 @@ func ResolveCommand(name, command string) (string, error) {
 
 // ValidateCommandExists checks if a command can be resolved
 func ValidateCommandExists(command string) error {
-	parts := strings.Fields(command)
+	parts, err := SplitCommand(command)
+	if err != nil {
+		return err
+	}
 	if len(parts) == 0 {
 		return fmt.Errorf("empty command")
 	}
 
-	_, err := exec.LookPath(parts[0])
+	_, err = exec.LookPath(parts[0])
 	return err
 }
 
@@ -154,26 +285,29 @@ func ExecutePreprocessor(name string, ppCfg *config.PreprocessorConfig, book *mo
 	}
 
 	ep := &ExternalPreprocessor{
-		Name:       name,
-		Command:    ppCfg.Command,
-		Renderers:  ppCfg.Renderers,
-		Book:       book,
-		Config:     cfg,
-		Renderer:   renderer,
-		ExtraProps: ppCfg.Extra,
+		Name:              name,
+		Command:           ppCfg.Command,
+		Renderers:         ppCfg.Renderers,
+		Book:              book,
+		Config:            cfg,
+		Renderer:          renderer,
+		Cwd:               ppCfg.Cwd,
+		Env:               ppCfg.Env,
+		Timeout:           ppCfg.Timeout,
+		Persistent:        ppCfg.Persistent,
+		Verbose:           verbose,
+		ExtraProps:        ppCfg.Extra,
+		SkipSupportsCheck: ppCfg.SkipSupportsCheck,
 	}
 
 	return ep.RunExternal()
 }
 
-// isBuiltinPreprocessor checks if a preprocessor is built-in (runs in-process)
+// isBuiltinPreprocessor checks if a preprocessor is built-in or registered with Register,
+// so it runs in-process
 func isBuiltinPreprocessor(name string) bool {
-	// Built-in preprocessors: index and frontmatter
-	builtins := map[string]bool{
-		"index":       true,
-		"frontmatter": true,
-	}
-	return builtins[name]
+	_, ok := registered(name)
+	return ok
 }
 
 // GetBuiltinPreprocessors returns the list of built-in preprocessor names
@@ -184,29 +318,22 @@ func GetBuiltinPreprocessors() []string {
 
 // PrepareWorkingDirectory resolves paths in commands relative to the book root
 // For example, "node preprocessors/example.js" becomes "node <bookroot>/preprocessors/example.js"
+// and "./bin/pp" becomes "<bookroot>/bin/pp"; "node" is left for the PATH lookup
 func PrepareWorkingDirectory(command string, bookRoot string) string {
-	parts := strings.Fields(command)
-	if len(parts) < 2 {
+	parts, err := SplitCommand(command)
+	if err != nil || len(parts) == 0 {
 		return command
 	}
 
-	// Resolve paths that don't start with / or a drive letter (for Windows)
-	// and aren't known commands
-	resolved := []string{parts[0]}
-	for i := 1; i < len(parts); i++ {
-		part := parts[i]
-		// Check if it looks like a path (contains / or \)
-		if strings.ContainsAny(part, `/\`) {
-			// Check if it's relative
-			if !filepath.IsAbs(part) {
-				// Make it relative to bookRoot
-				part = filepath.Join(bookRoot, part)
-			}
+	// Resolve relative arguments that look like a path (contain / or \); absolute
+	// paths, including those with a Windows drive letter, are kept
+	for i, part := range parts {
+		if strings.ContainsAny(part, `/\`) && !filepath.IsAbs(part) {
+			parts[i] = filepath.Join(bookRoot, part)
 		}
-		resolved = append(resolved, part)
 	}
 
-	return strings.Join(resolved, " ")
+	return JoinCommand(parts)
 }
 
 // GetCommandSearchPaths returns directories to search for preprocessor commands
@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+)
+
+// TestExternalHelperProcess is the preprocessor started by TestExternalOptions. It writes
+// its working directory and GEOPUB_TEST_GREETING into the first chapter, or sleeps
+// when the chapter says so.
+func TestExternalHelperProcess(t *testing.T) {
+	if os.Getenv("GEOPUB_TEST_EXTERNAL_HELPER") != "1" {
+		return
+	}
+	if args := os.Args; args[len(args)-2] == "supports" {
+		os.Exit(0)
+	}
+	data, _ := io.ReadAll(os.Stdin)
+	ctx, err := UnmarshalContext(data)
+	if err != nil {
+		os.Exit(2)
+	}
+	ch := ctx.Book.Sections[0].Chapter
+	if ch.Content == "sleep" {
+		time.Sleep(10 * time.Second)
+	}
+	wd, _ := os.Getwd()
+	ch.Content = filepath.Base(wd) + " " + os.Getenv("GEOPUB_TEST_GREETING")
+	out, _ := json.Marshal(ctx)
+	os.Stdout.Write(out)
+	os.Exit(0)
+}
+
+func TestExternalOptions(t *testing.T) {
+	t.Setenv("GEOPUB_TEST_EXTERNAL_HELPER", "1")
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "scripts"), 0755); err != nil {
+		t.Fatalf("Mkdir() error: %v", err)
+	}
+	cfg, err := config.LoadFromString(fmt.Sprintf(`
+[book]
+title = "Test"
+
+[preprocessor.helper]
+command = %q
+cwd = "scripts"
+timeout = 2
+
+[preprocessor.helper.env]
+GEOPUB_TEST_GREETING = "hello world"
+`, JoinCommand([]string{os.Args[0], "-test.run=^TestExternalHelperProcess$"})))
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+
+	run := func(content string) (string, error) {
+		book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", content, "one.md", nil)})
+		r := NewRunner(cfg, "html")
+		r.SetRoot(root)
+		if err := r.Run(book); err != nil {
+			return "", err
+		}
+		return book.Items[0].(*models.Chapter).Content, nil
+	}
+
+	got, err := run("text")
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got != "scripts hello world" {
+		t.Errorf("expected cwd and env to apply, got %q", got)
+	}
+
+	start := time.Now()
+	if _, err := run("sleep"); err == nil || !strings.Contains(err.Error(), "preprocessor 'helper' timed out after 2s") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	// The timeout leaves room for starting the helper under -race, and the helper sleeps
+	// well past it, so only a killed helper finishes in time
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+}
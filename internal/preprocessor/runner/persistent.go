@@ -0,0 +1,275 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	sdk "github.com/geocine/geopub/pkg/preprocessor"
+)
+
+// PersistentEnv is set to "1" in the environment of preprocessors started in persistent mode
+const PersistentEnv = sdk.PersistentEnv
+
+// persistentResponse is a line written by a persistent preprocessor: the processed
+// context, or an error that fails the build
+type persistentResponse struct {
+	PreprocessorContext
+	Error string `json:"error,omitempty"`
+}
+
+// errPersistentTimeout is returned when a persistent preprocessor doesn't answer in time
+var errPersistentTimeout = errors.New("timed out")
+
+// persistentProcesses holds the running persistent preprocessors, keyed by invocation,
+// so they are reused across builds
+var (
+	persistentMu        sync.Mutex
+	persistentProcesses = map[string]*persistentProcess{}
+)
+
+// stderrSettle is how long a failed request waits for the stderr output the process
+// wrote before answering, which is copied separately from its response
+const stderrSettle = 50 * time.Millisecond
+
+// persistentProcess is a long-running preprocessor that handles one request at a time
+type persistentProcess struct {
+	inv *invocation
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *stderrCapture
+	exited chan struct{} // Closed when the process exits
+	starts int
+
+	// supports holds the answers of `supports` probes for as long as the process lives,
+	// so rebuilds during serve don't start a probe each
+	supportsMu sync.Mutex
+	supports   map[string]supportsAnswer
+}
+
+// stderrCapture collects what a persistent process writes to stderr during a request,
+// so a failing request can report it. In verbose mode it is streamed to the terminal too.
+type stderrCapture struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	verbose bool
+}
+
+func (c *stderrCapture) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.verbose {
+		os.Stderr.Write(b)
+	}
+	return c.buf.Write(b)
+}
+
+// reset discards what was captured before the next request
+func (c *stderrCapture) reset(verbose bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf.Reset()
+	c.verbose = verbose
+}
+
+func (c *stderrCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
+
+// persistentProcessFor returns the persistent process for inv
+func persistentProcessFor(inv *invocation) *persistentProcess {
+	persistentMu.Lock()
+	defer persistentMu.Unlock()
+	key := inv.key()
+	p, ok := persistentProcesses[key]
+	if !ok {
+		p = &persistentProcess{inv: inv}
+		persistentProcesses[key] = p
+	}
+	return p
+}
+
+// StopPersistent stops every persistent preprocessor
+func StopPersistent() {
+	persistentMu.Lock()
+	procs := persistentProcesses
+	persistentProcesses = map[string]*persistentProcess{}
+	persistentMu.Unlock()
+	for _, p := range procs {
+		p.mu.Lock()
+		p.stop()
+		p.mu.Unlock()
+	}
+}
+
+// request sends input as one line and returns the line the process answers with, and
+// what the process wrote to stderr meanwhile. A process that has crashed is restarted,
+// and a request that fails because the process went away is retried once on a fresh
+// process. A process that times out is killed.
+func (p *persistentProcess) request(input []byte, timeout time.Duration, verbose bool) ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fresh := false
+	for {
+		if !p.running() {
+			if err := p.start(); err != nil {
+				return nil, "", err
+			}
+			fresh = true
+		}
+		p.stderr.reset(verbose)
+		output, err := p.exchange(input, timeout)
+		if err == nil {
+			return output, p.stderr.String(), nil
+		}
+		// Stopping waits for the process to exit, and with it for its stderr
+		p.stop()
+		if fresh || errors.Is(err, errPersistentTimeout) {
+			return nil, p.stderr.String(), err
+		}
+		// The process died since the previous build; the next round starts a new one
+	}
+}
+
+// supportsAnswer returns the remembered answer of the probe for renderer
+func (p *persistentProcess) supportsAnswer(renderer string) (supportsAnswer, bool) {
+	p.supportsMu.Lock()
+	defer p.supportsMu.Unlock()
+	answer, ok := p.supports[renderer]
+	return answer, ok
+}
+
+// rememberSupports keeps the answer of the probe for renderer until the process restarts
+func (p *persistentProcess) rememberSupports(renderer string, answer supportsAnswer) {
+	p.supportsMu.Lock()
+	defer p.supportsMu.Unlock()
+	if p.supports == nil {
+		p.supports = map[string]supportsAnswer{}
+	}
+	p.supports[renderer] = answer
+}
+
+// settledStderr returns the stderr output of the current request once the output the
+// process wrote before answering has arrived
+func (p *persistentProcess) settledStderr() string {
+	time.Sleep(stderrSettle)
+	return p.stderr.String()
+}
+
+// running reports whether the process has been started and hasn't exited; p.mu must be held
+func (p *persistentProcess) running() bool {
+	if p.cmd == nil {
+		return false
+	}
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// start launches the process; p.mu must be held
+func (p *persistentProcess) start() error {
+	if p.starts > 0 {
+		// A restarted process may be a different program by now
+		p.supportsMu.Lock()
+		p.supports = nil
+		p.supportsMu.Unlock()
+	}
+	p.starts++
+
+	// The process outlives the build, so it isn't bound to a context
+	cmd := p.inv.command(context.Background())
+	cmd.Env = append(cmd.Env, PersistentEnv+"=1")
+	stderr := &stderrCapture{}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	p.cmd, p.stdin, p.stdout, p.stderr, p.exited = cmd, stdin, bufio.NewReader(stdout), stderr, exited
+	return nil
+}
+
+// exchange writes one request and reads one response line; p.mu must be held
+func (p *persistentProcess) exchange(input []byte, timeout time.Duration) ([]byte, error) {
+	type result struct {
+		line []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		if _, err := p.stdin.Write(append(input, '\n')); err != nil {
+			done <- result{err: fmt.Errorf("failed to send request: %w", err)}
+			return
+		}
+		line, err := p.stdout.ReadBytes('\n')
+		if err != nil {
+			done <- result{err: fmt.Errorf("failed to read response: %w", err)}
+			return
+		}
+		done <- result{line: bytes.TrimSpace(line)}
+	}()
+
+	select {
+	case r := <-done:
+		return r.line, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%w after %s", errPersistentTimeout, timeout)
+	}
+}
+
+// stop closes stdin and kills the process if it doesn't exit by itself; p.mu must be held
+func (p *persistentProcess) stop() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	select {
+	case <-p.exited:
+	case <-time.After(time.Second):
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+	p.cmd = nil
+}
+
+// decodePersistentResponse turns a response line into the context it carries
+func decodePersistentResponse(line []byte) (*PreprocessorContext, error) {
+	var resp persistentResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return &resp.PreprocessorContext, nil
+}
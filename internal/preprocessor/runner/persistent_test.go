@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+)
+
+// TestPersistentHelperProcess is the persistent preprocessor started by the tests below.
+// It appends a request counter and its pid to the first chapter, and logs supports probes
+// to GEOPUB_TEST_PROBE_LOG.
+func TestPersistentHelperProcess(t *testing.T) {
+	if os.Getenv("GEOPUB_TEST_PERSISTENT_HELPER") != "1" {
+		return
+	}
+	if args := os.Args; args[len(args)-2] == "supports" {
+		f, _ := os.OpenFile(os.Getenv("GEOPUB_TEST_PROBE_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		fmt.Fprintln(f, args[len(args)-1])
+		f.Close()
+		os.Exit(0)
+	}
+	if os.Getenv(PersistentEnv) != "1" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		ctx, err := UnmarshalContext(scanner.Bytes())
+		if err != nil {
+			os.Exit(2)
+		}
+		ch := ctx.Book.Sections[0].Chapter
+		if ch.Content == "fail" {
+			fmt.Fprintln(os.Stderr, "bad input")
+			fmt.Println(`{"error":"boom"}`)
+			continue
+		}
+		ch.Content += fmt.Sprintf(" #%d pid=%d", n, os.Getpid())
+		out, _ := json.Marshal(ctx)
+		fmt.Println(string(out))
+	}
+	os.Exit(0)
+}
+
+func TestPersistentPreprocessor(t *testing.T) {
+	t.Setenv("GEOPUB_TEST_PERSISTENT_HELPER", "1")
+	logPath := t.TempDir() + "/probes.log"
+	t.Setenv("GEOPUB_TEST_PROBE_LOG", logPath)
+	t.Cleanup(StopPersistent)
+	cfg, err := config.LoadFromString(fmt.Sprintf(`
+[book]
+title = "Test"
+
+[preprocessor.echo]
+command = %q
+persistent = true
+`, os.Args[0]+" -test.run=^TestPersistentHelperProcess$"))
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+
+	run := func(content string) (string, error) {
+		book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", content, "one.md", nil)})
+		if err := NewRunner(cfg, "html").Run(book); err != nil {
+			return "", err
+		}
+		return book.Items[0].(*models.Chapter).Content, nil
+	}
+	probes := func() int {
+		data, _ := os.ReadFile(logPath)
+		return len(strings.Fields(string(data)))
+	}
+
+	first, err := run("a")
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	second, err := run("b")
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	pid := strings.TrimPrefix(first, "a #1 ")
+	if second != "b #2 "+pid {
+		t.Fatalf("second build should reuse the process (%q), got %q", first, second)
+	}
+
+	// A failure reported by the preprocessor fails the build, showing its stderr
+	if _, err := run("fail"); err == nil || !strings.Contains(err.Error(), "boom") || !strings.Contains(err.Error(), "stderr: bad input") {
+		t.Fatalf("expected the preprocessor error and its stderr, got %v", err)
+	}
+
+	// Every build has its own runner, but the process is only probed once
+	if n := probes(); n != 1 {
+		t.Fatalf("expected one supports probe for the life of the process, got %d", n)
+	}
+
+	// A crashed process is restarted
+	var n int
+	fmt.Sscanf(pid, "pid=%d", &n)
+	proc, err := os.FindProcess(n)
+	if err != nil {
+		t.Fatalf("FindProcess() error: %v", err)
+	}
+	proc.Kill()
+	third, err := run("c")
+	if err != nil {
+		t.Fatalf("Run() after crash error: %v", err)
+	}
+	if !strings.HasPrefix(third, "c #1 pid=") || third == "c #1 "+pid {
+		t.Fatalf("expected a fresh process, got %q", third)
+	}
+
+	// and probed again on the next build, since it may be a different program by now
+	if _, err := run("d"); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if n := probes(); n != 2 {
+		t.Fatalf("expected a new supports probe after the restart, got %d", n)
+	}
+}
@@ -5,66 +5,55 @@ import (
 
 	"github.com/geocine/geopub/internal/config"
 	"github.com/geocine/geopub/internal/models"
+	sdk "github.com/geocine/geopub/pkg/preprocessor"
 )
 
+// The protocol types are owned by the public SDK, so GeoPub speaks exactly the protocol
+// it documents
+
 // PreprocessorContext is the JSON structure sent to and received from preprocessors
-// It matches the mdBook preprocessor protocol
-type PreprocessorContext struct {
-	Book     *JsonBook              `json:"book"`
-	Config   map[string]interface{} `json:"config"`
-	Renderer string                 `json:"renderer"`
-	Version  string                 `json:"version"`
-}
+type PreprocessorContext = sdk.Context
 
 // JsonBook represents a book in the preprocessor protocol
-type JsonBook struct {
-	Sections []JsonSection `json:"sections"`
-	// Root path to the book (for context)
-	Root string `json:"root,omitempty"`
-}
+type JsonBook = sdk.Book
 
-// JsonSection represents a section (chapter or separator) in the preprocessor protocol
-type JsonSection struct {
-	Chapter *JsonChapter `json:"chapter,omitempty"`
-	// Separator appears as { "separator": {} } in mdBook
-	IsSeparator bool `json:"separator,omitempty"`
-}
+// JsonSection represents a section (chapter, separator or part title) in the preprocessor protocol
+type JsonSection = sdk.Section
 
 // JsonChapter represents a chapter in the preprocessor protocol
-type JsonChapter struct {
-	Name     string        `json:"name"`
-	Content  string        `json:"content"`
-	Number   []int         `json:"number,omitempty"`
-	SubItems []JsonSection `json:"sub_items"`
-	Path     string        `json:"path,omitempty"`
-}
+type JsonChapter = sdk.Chapter
 
 // BookToJson converts a GeoPub book to the JSON representation for preprocessors
 func BookToJson(book *models.Book) *JsonBook {
-	jsonBook := &JsonBook{
-		Sections: []JsonSection{},
+	return &JsonBook{
+		Sections: itemsToJsonSections(book.Items),
 	}
+}
 
-	for _, item := range book.Items {
+// itemsToJsonSections converts book items to JSON sections
+func itemsToJsonSections(items []models.BookItem) []JsonSection {
+	sections := []JsonSection{}
+	for _, item := range items {
 		switch v := item.(type) {
 		case *models.Chapter:
-			jsonBook.Sections = append(jsonBook.Sections, chapterToJsonSection(v))
+			sections = append(sections, chapterToJsonSection(v))
 		case *models.Separator:
-			jsonBook.Sections = append(jsonBook.Sections, JsonSection{IsSeparator: true})
+			sections = append(sections, JsonSection{IsSeparator: true})
 		case *models.PartTitle:
-			// PartTitle doesn't map directly; skip it for now
+			sections = append(sections, JsonSection{PartTitle: v.Title})
 		}
 	}
-
-	return jsonBook
+	return sections
 }
 
 // chapterToJsonSection converts a chapter to a JSON section
 func chapterToJsonSection(ch *models.Chapter) JsonSection {
 	jsonCh := &JsonChapter{
-		Name:     ch.Name,
-		Content:  ch.Content,
-		SubItems: []JsonSection{},
+		Name:        ch.Name,
+		Content:     ch.Content,
+		SubItems:    itemsToJsonSections(ch.SubItems),
+		ParentNames: append([]string{}, ch.ParentNames...),
+		Metadata:    ch.Metadata,
 	}
 
 	// Convert section number
@@ -72,19 +61,12 @@ func chapterToJsonSection(ch *models.Chapter) JsonSection {
 		jsonCh.Number = ch.Number.Parts
 	}
 
-	// Set path if available
-	if ch.Path != nil {
+	// Draft chapters have no path
+	if ch.Path != nil && !ch.IsDraft {
 		jsonCh.Path = *ch.Path
 	}
-
-	// Convert sub-items
-	for _, subItem := range ch.SubItems {
-		switch v := subItem.(type) {
-		case *models.Chapter:
-			jsonCh.SubItems = append(jsonCh.SubItems, chapterToJsonSection(v))
-		case *models.Separator:
-			jsonCh.SubItems = append(jsonCh.SubItems, JsonSection{IsSeparator: true})
-		}
+	if ch.SourcePath != nil {
+		jsonCh.SourcePath = *ch.SourcePath
 	}
 
 	return JsonSection{Chapter: jsonCh}
@@ -93,36 +75,54 @@ func chapterToJsonSection(ch *models.Chapter) JsonSection {
 // JsonToBook converts the JSON representation back to a GeoPub book, applying mutations
 func JsonToBook(jsonBook *JsonBook, originalBook *models.Book) error {
 	// Create a new book from the JSON structure
-	newItems := []models.BookItem{}
+	newItems, err := jsonSectionsToItems(jsonBook.Sections)
+	if err != nil {
+		return err
+	}
+
+	// Replace the book's items
+	originalBook.Items = newItems
+	return nil
+}
 
-	for _, section := range jsonBook.Sections {
-		if section.IsSeparator {
-			newItems = append(newItems, &models.Separator{})
-		} else if section.Chapter != nil {
+// jsonSectionsToItems converts JSON sections back to book items
+func jsonSectionsToItems(sections []JsonSection) ([]models.BookItem, error) {
+	items := []models.BookItem{}
+	for _, section := range sections {
+		switch {
+		case section.IsSeparator:
+			items = append(items, &models.Separator{})
+		case section.PartTitle != "":
+			items = append(items, &models.PartTitle{Title: section.PartTitle})
+		case section.Chapter != nil:
 			ch, err := jsonChapterToChapter(section.Chapter)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			newItems = append(newItems, ch)
+			items = append(items, ch)
 		}
 	}
-
-	// Replace the book's items
-	originalBook.Items = newItems
-	return nil
+	return items, nil
 }
 
 // jsonChapterToChapter converts a JSON chapter to a GeoPub chapter
 func jsonChapterToChapter(jsonCh *JsonChapter) (*models.Chapter, error) {
 	ch := &models.Chapter{
-		Name:     jsonCh.Name,
-		Content:  jsonCh.Content,
-		SubItems: []models.BookItem{},
+		Name:        jsonCh.Name,
+		Content:     jsonCh.Content,
+		ParentNames: jsonCh.ParentNames,
+		IsDraft:     jsonCh.Path == "",
+		Metadata:    jsonCh.Metadata,
 	}
 
-	// Set path if available
+	// Set paths if available
 	if jsonCh.Path != "" {
-		ch.Path = &jsonCh.Path
+		path := jsonCh.Path
+		ch.Path = &path
+	}
+	if jsonCh.SourcePath != "" {
+		sourcePath := jsonCh.SourcePath
+		ch.SourcePath = &sourcePath
 	}
 
 	// Convert number
@@ -131,24 +131,27 @@ func jsonChapterToChapter(jsonCh *JsonChapter) (*models.Chapter, error) {
 	}
 
 	// Convert sub-items
-	for _, subSection := range jsonCh.SubItems {
-		if subSection.IsSeparator {
-			ch.SubItems = append(ch.SubItems, &models.Separator{})
-		} else if subSection.Chapter != nil {
-			subCh, err := jsonChapterToChapter(subSection.Chapter)
-			if err != nil {
-				return nil, err
-			}
-			ch.SubItems = append(ch.SubItems, subCh)
-		}
+	subItems, err := jsonSectionsToItems(jsonCh.SubItems)
+	if err != nil {
+		return nil, err
 	}
+	ch.SubItems = subItems
 
 	return ch, nil
 }
 
 // NewPreprocessorContext creates a context for passing to a preprocessor
 func NewPreprocessorContext(book *models.Book, cfg *config.Config, renderer string) *PreprocessorContext {
-	// Convert config to map for JSON marshaling
+	return &PreprocessorContext{
+		Book:     BookToJson(book),
+		Config:   ConfigToJson(cfg),
+		Renderer: renderer,
+		Version:  "0.1",
+	}
+}
+
+// ConfigToJson converts the book config to the map sent to preprocessors and external renderers
+func ConfigToJson(cfg *config.Config) map[string]interface{} {
 	configMap := make(map[string]interface{})
 	if cfg != nil {
 		// Include book config
@@ -157,21 +160,17 @@ func NewPreprocessorContext(book *models.Book, cfg *config.Config, renderer stri
 			"authors":     cfg.Book.Authors,
 			"description": cfg.Book.Description,
 			"language":    cfg.Book.Language,
+			"src":         cfg.Book.Src,
 		}
 		// Include build config
 		configMap["build"] = map[string]interface{}{
 			"build-dir": cfg.Build.BuildDir,
 		}
-		// Include preprocessor configs
+		// Include output and preprocessor configs
+		configMap["output"] = cfg.Output
 		configMap["preprocessor"] = cfg.Preprocessor
 	}
-
-	return &PreprocessorContext{
-		Book:     BookToJson(book),
-		Config:   configMap,
-		Renderer: renderer,
-		Version:  "0.1",
-	}
+	return configMap
 }
 
 // UnmarshalContext unmarshals a context from JSON
@@ -2,6 +2,8 @@ package runner
 
 import (
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/geocine/geopub/internal/models"
@@ -242,3 +244,60 @@ func TestNestedChapters(t *testing.T) {
 		t.Fatalf("expected 'Child', got '%s'", resultChild.Name)
 	}
 }
+
+func TestRoundTripIsLossless(t *testing.T) {
+	// One of every BookItem type, at the top level and nested
+	intro := models.NewChapter("Intro", "# Intro", "intro.md", []string{})
+	intro.Number = &models.SectionNumber{Parts: []int{1}}
+	sourcePath := "/book/src/intro.md"
+	intro.SourcePath = &sourcePath
+	intro.Metadata = map[string]any{
+		"description": "Start here",
+		"tags":        []any{"basics"},
+		"draft":       false,
+	}
+
+	setup := models.NewChapter("Setup", "# Setup", "guide/setup.md", []string{"Guide"})
+	setup.Number = &models.SectionNumber{Parts: []int{2, 1}}
+	guide := models.NewChapter("Guide", "# Guide", "guide/index.md", []string{})
+	guide.Number = &models.SectionNumber{Parts: []int{2}}
+	guide.SubItems = []models.BookItem{
+		setup,
+		&models.Separator{},
+		models.NewDraftChapter("Later", []string{"Guide"}),
+	}
+
+	book := models.NewBookWithItems([]models.BookItem{
+		intro,
+		&models.PartTitle{Title: "Reference"},
+		guide,
+		&models.Separator{},
+		models.NewDraftChapter("Appendix", []string{}),
+	})
+
+	data, err := json.Marshal(NewPreprocessorContext(book, nil, "html"))
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	if !strings.Contains(string(data), `{"part_title":"Reference"}`) {
+		t.Errorf("part title missing from JSON: %s", data)
+	}
+	ctx, err := UnmarshalContext(data)
+	if err != nil {
+		t.Fatalf("UnmarshalContext() error: %v", err)
+	}
+
+	result := models.NewBook()
+	if err := JsonToBook(ctx.Book, result); err != nil {
+		t.Fatalf("JsonToBook() error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Items, book.Items) {
+		got, _ := json.Marshal(BookToJson(result))
+		t.Fatalf("round-trip changed the book:\n got: %s\nwant: %s", got, data)
+	}
+
+	draft := result.Items[4].(*models.Chapter)
+	if !draft.IsDraft || draft.Path != nil {
+		t.Errorf("expected a draft chapter without path, got %+v", draft)
+	}
+}
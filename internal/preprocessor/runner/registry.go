@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/geocine/geopub/internal/preprocessor"
+	"github.com/geocine/geopub/internal/preprocessor/frontmatter"
+	"github.com/geocine/geopub/internal/preprocessor/index"
+)
+
+// registry holds the preprocessors that run in-process: the built-in ones and the ones
+// added with Register
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]preprocessor.Preprocessor{}
+)
+
+func init() {
+	Register("index", index.NewIndexPreprocessor())
+	Register("frontmatter", frontmatter.NewFrontmatterPreprocessor())
+}
+
+// Register adds an in-process preprocessor, so a build of GeoPub can ship its own Go
+// preprocessors next to the built-in ones. Code outside this module reaches it through
+// plugin.Register in pkg/plugin. Like frontmatter, a registered preprocessor runs for
+// books that have a [preprocessor.<name>] table, honoring its before, after and
+// renderers settings, and is never started as a command. Process gets the book
+// directly, without the JSON round-trip, and may be called concurrently when several
+// books are built at once. Register panics if the name is empty or already taken.
+func Register(name string, p preprocessor.Preprocessor) {
+	if name == "" || p == nil {
+		panic("runner: Register needs a name and a preprocessor")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("runner: preprocessor %q is already registered", name))
+	}
+	registry[name] = p
+}
+
+// registered returns the in-process preprocessor called name
+func registered(name string) (preprocessor.Preprocessor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[name]
+	return p, ok
+}
+
+// RegisteredPreprocessors returns the names of the in-process preprocessors, sorted
+func RegisteredPreprocessors() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+)
+
+// appendPreprocessor appends its name to the first chapter
+type appendPreprocessor struct{ name string }
+
+func (p appendPreprocessor) Name() string { return p.name }
+
+func (p appendPreprocessor) Process(book *models.Book) error {
+	ch := book.Items[0].(*models.Chapter)
+	ch.Content += " " + p.name
+	return nil
+}
+
+func init() {
+	Register("test-first", appendPreprocessor{"test-first"})
+	Register("test-second", appendPreprocessor{"test-second"})
+	Register("test-unused", appendPreprocessor{"test-unused"})
+}
+
+func TestRegisteredPreprocessorsRunInProcess(t *testing.T) {
+	// No command exists for these; they must not be started as external preprocessors.
+	// test-unused isn't configured, so ordering against it is ignored.
+	cfg, err := config.LoadFromString(`
+[book]
+title = "Test"
+
+[preprocessor.test-second]
+after = ["test-first", "test-unused"]
+
+[preprocessor.test-first]
+after = ["index"]
+
+[preprocessor.epub-only]
+command = "does-not-exist"
+renderers = ["epub"]
+`)
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+
+	r := NewRunner(cfg, "html")
+	order, err := r.GetExecutionOrder()
+	if err != nil {
+		t.Fatalf("GetExecutionOrder() error: %v", err)
+	}
+	pos := map[string]int{}
+	for i, name := range order {
+		pos[name] = i
+	}
+	if _, ok := pos["test-unused"]; ok {
+		t.Errorf("unconfigured preprocessor should not run: %v", order)
+	}
+	if !(pos["index"] < pos["test-first"] && pos["test-first"] < pos["test-second"]) {
+		t.Errorf("unexpected order: %v", order)
+	}
+
+	book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "text", "one.md", nil)})
+	if err := r.Run(book); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := book.Items[0].(*models.Chapter).Content; got != "text test-first test-second" {
+		t.Errorf("unexpected content: %q", got)
+	}
+
+	// Built-in defaults being off doesn't break constraints on them
+	r.SetIncludeDefaults(false)
+	if _, err := r.GetExecutionOrder(); err != nil {
+		t.Errorf("GetExecutionOrder() without defaults error: %v", err)
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Register to panic for a taken name")
+		}
+	}()
+	Register("index", appendPreprocessor{"index"})
+}
+
+func TestRegisteredPreprocessors(t *testing.T) {
+	names := map[string]bool{}
+	for _, name := range RegisteredPreprocessors() {
+		names[name] = true
+	}
+	for _, name := range []string{"index", "frontmatter", "test-first"} {
+		if !names[name] || !isBuiltinPreprocessor(name) {
+			t.Errorf("expected %s to be registered, got %v", name, RegisteredPreprocessors())
+		}
+	}
+}
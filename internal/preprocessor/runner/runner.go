@@ -6,18 +6,17 @@ import (
 
 	"github.com/geocine/geopub/internal/config"
 	"github.com/geocine/geopub/internal/models"
-	"github.com/geocine/geopub/internal/preprocessor/frontmatter"
-	"github.com/geocine/geopub/internal/preprocessor/index"
 )
 
 // Runner manages the preprocessor pipeline
 type Runner struct {
-	cfg                  *config.Config
-	renderer             string
-	verbose              bool
-	disableExternals     bool
-	includeDefaults      bool
-	builtinPreprocessors map[string]func(*models.Book) error
+	cfg              *config.Config
+	renderer         string
+	root             string
+	verbose          bool
+	disableExternals bool
+	includeDefaults  bool
+	supports         *SupportsCache
 }
 
 // NewRunner creates a new preprocessor runner
@@ -28,16 +27,7 @@ func NewRunner(cfg *config.Config, renderer string) *Runner {
 		verbose:          false,
 		disableExternals: false,
 		includeDefaults:  cfg.Build.UseDefaultPreprocessors,
-		builtinPreprocessors: map[string]func(*models.Book) error{
-			"index": func(book *models.Book) error {
-				idx := index.NewIndexPreprocessor()
-				return idx.Process(book)
-			},
-			"frontmatter": func(book *models.Book) error {
-				fm := frontmatter.NewFrontmatterPreprocessor()
-				return fm.Process(book)
-			},
-		},
+		supports:         NewSupportsCache(),
 	}
 }
 
@@ -46,6 +36,16 @@ func (r *Runner) SetVerbose(verbose bool) {
 	r.verbose = verbose
 }
 
+// SetRoot sets the book root that external preprocessors run in (default: the working directory)
+func (r *Runner) SetRoot(root string) {
+	r.root = root
+}
+
+// SetSupportsCache shares the answers of `supports` probes with the other runners of a build
+func (r *Runner) SetSupportsCache(cache *SupportsCache) {
+	r.supports = cache
+}
+
 // SetDisableExternals disables external preprocessor execution
 func (r *Runner) SetDisableExternals(disable bool) {
 	r.disableExternals = disable
@@ -90,17 +90,23 @@ func (r *Runner) Run(book *models.Book) error {
 
 	// Execute each preprocessor in order
 	for _, name := range orderedNames {
-		// Check if it's a built-in
-		if isBuiltinPreprocessor(name) {
+		// Check renderer filter
+		if ppCfg, ok := configuredPreprocessors[name]; ok && !r.supportsRenderer(ppCfg) {
+			if r.verbose {
+				fmt.Printf("Skipping preprocessor: %s (renderer '%s' not in renderers list)\n", name, r.renderer)
+			}
+			continue
+		}
+
+		// Check if it's a built-in or registered with Register
+		if p, ok := registered(name); ok {
 			if r.verbose {
 				fmt.Printf("Running preprocessor: %s (built-in)\n", name)
 			}
 
-			// Run built-in
-			if fn, ok := r.builtinPreprocessors[name]; ok {
-				if err := fn(book); err != nil {
-					return fmt.Errorf("preprocessor '%s' failed: %w", name, err)
-				}
+			// Run in-process
+			if err := p.Process(book); err != nil {
+				return fmt.Errorf("preprocessor '%s' failed: %w", name, err)
 			}
 		} else {
 			// External preprocessor
@@ -117,43 +123,39 @@ func (r *Runner) Run(book *models.Book) error {
 				continue
 			}
 
-			if r.verbose {
-				if ppCfg.Command != "" {
-					fmt.Printf("Running preprocessor: %s (external): %s\n", name, ppCfg.Command)
-				} else {
-					fmt.Printf("Running preprocessor: %s (external): geopub-%s\n", name, name)
-				}
+			ep := &ExternalPreprocessor{
+				Name:              name,
+				Command:           ppCfg.Command,
+				Renderers:         ppCfg.Renderers,
+				Book:              book,
+				Config:            r.cfg,
+				Renderer:          r.renderer,
+				Root:              r.root,
+				Cwd:               ppCfg.Cwd,
+				Env:               ppCfg.Env,
+				Timeout:           ppCfg.Timeout,
+				Persistent:        ppCfg.Persistent,
+				Verbose:           r.verbose,
+				ExtraProps:        ppCfg.Extra,
+				Supports:          r.supports,
+				SkipSupportsCheck: ppCfg.SkipSupportsCheck,
 			}
 
-			// Check renderer filter
-			if len(ppCfg.Renderers) > 0 {
-				found := false
-				for _, rend := range ppCfg.Renderers {
-					if rend == r.renderer {
-						found = true
-						break
-					}
-				}
-				if !found {
-					if r.verbose {
-						fmt.Printf("  (skipped - renderer '%s' not in renderers list)\n", r.renderer)
-					}
-					continue
-				}
+			// Like mdBook, ask the preprocessor whether it supports the renderer
+			supported, err := ep.checkSupported()
+			if err != nil {
+				return err
+			}
+			if !supported {
+				continue
 			}
 
-			// Run external
-			ep := &ExternalPreprocessor{
-				Name:       name,
-				Command:    ppCfg.Command,
-				Renderers:  ppCfg.Renderers,
-				Book:       book,
-				Config:     r.cfg,
-				Renderer:   r.renderer,
-				ExtraProps: ppCfg.Extra,
+			if r.verbose {
+				fmt.Printf("Running preprocessor: %s (external): %s\n", name, ep.command())
 			}
 
-			if err := ep.RunExternal(); err != nil {
+			// Run external
+			if err := ep.process(); err != nil {
 				return fmt.Errorf("preprocessor '%s' failed: %w", name, err)
 			}
 		}
@@ -162,6 +164,20 @@ func (r *Runner) Run(book *models.Book) error {
 	return nil
 }
 
+// supportsRenderer reports whether a preprocessor applies to the runner's renderer
+// An empty renderers list means the preprocessor applies to all renderers
+func (r *Runner) supportsRenderer(ppCfg *config.PreprocessorConfig) bool {
+	if len(ppCfg.Renderers) == 0 {
+		return true
+	}
+	for _, rend := range ppCfg.Renderers {
+		if rend == r.renderer {
+			return true
+		}
+	}
+	return false
+}
+
 // GetExecutionOrder returns the preprocessors that will be executed (for testing/inspection)
 func (r *Runner) GetExecutionOrder() ([]string, error) {
 	configuredPreprocessors := r.cfg.GetPreprocessorConfigs()
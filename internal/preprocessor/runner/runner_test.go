@@ -126,3 +126,39 @@ This is the content.`, "test.md", []string{})
 		t.Errorf("frontmatter not stripped. Got: %q", result.Content)
 	}
 }
+
+func TestBuiltinRespectsRenderersList(t *testing.T) {
+	cfgStr := `
+[book]
+title = "Test"
+
+[preprocessor.frontmatter]
+renderers = ["html"]
+`
+	cfg, err := config.LoadFromString(cfgStr)
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+
+	content := "---\nauthor: Jane Doe\n---\n# Content\n"
+
+	// The markdown renderer is not in the list, so frontmatter must be left alone
+	book := models.NewBook()
+	book.PushItem(models.NewChapter("Test", content, "test.md", []string{}))
+	if err := NewRunner(cfg, "markdown").Run(book); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := book.Items[0].(*models.Chapter).Content; got != content {
+		t.Errorf("frontmatter should not run for markdown renderer. Got: %q", got)
+	}
+
+	// The html renderer is in the list
+	book = models.NewBook()
+	book.PushItem(models.NewChapter("Test", content, "test.md", []string{}))
+	if err := NewRunner(cfg, "html").Run(book); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := book.Items[0].(*models.Chapter).Content; got != "# Content\n" {
+		t.Errorf("frontmatter should run for html renderer. Got: %q", got)
+	}
+}
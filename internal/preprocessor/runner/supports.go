@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// SupportsCache remembers the answers of `<command> supports <renderer>` probes, so a
+// build asks every preprocessor at most once per renderer. Create one per build.
+type SupportsCache struct {
+	mu      sync.Mutex
+	answers map[string]supportsAnswer
+}
+
+// supportsAnswer is the outcome of a probe
+type supportsAnswer struct {
+	supported bool
+	reason    string // Why the preprocessor declined: its exit status and stderr
+}
+
+// NewSupportsCache returns an empty cache
+func NewSupportsCache() *SupportsCache {
+	return &SupportsCache{answers: map[string]supportsAnswer{}}
+}
+
+// SupportsRenderer asks the preprocessor whether it supports ep.Renderer by running
+// `<command> supports <renderer>`, as mdBook does. Exit status 0 means it does and any
+// other status means it is skipped; a command that can't be run is an error. Answers
+// are cached in ep.Supports when set, or for persistent preprocessors until their process
+// restarts. Preprocessors with SkipSupportsCheck always run.
+func (ep *ExternalPreprocessor) SupportsRenderer() (bool, error) {
+	answer, err := ep.supports()
+	return answer.supported, err
+}
+
+// checkSupported probes the preprocessor like SupportsRenderer, warning when it is
+// skipped, since filters written before the probe existed decline by failing on it
+func (ep *ExternalPreprocessor) checkSupported() (bool, error) {
+	answer, err := ep.supports()
+	if err != nil {
+		return false, fmt.Errorf("preprocessor '%s' failed: %w", ep.Name, err)
+	}
+	if !answer.supported {
+		log.Printf("Warning: skipping preprocessor '%s' for renderer '%s': `supports %s` check %s; set supports-check = false in [preprocessor.%s] to run it without asking",
+			ep.Name, ep.Renderer, ep.Renderer, answer.reason, ep.Name)
+	}
+	return answer.supported, nil
+}
+
+// supports returns the cached or probed answer for ep.Renderer
+func (ep *ExternalPreprocessor) supports() (supportsAnswer, error) {
+	if ep.SkipSupportsCheck {
+		return supportsAnswer{supported: true}, nil
+	}
+	inv, err := ep.invocation()
+	if err != nil {
+		return supportsAnswer{}, err
+	}
+	if ep.Persistent {
+		// Answers live as long as the process, across the builds of a serve session
+		proc := persistentProcessFor(inv)
+		if answer, ok := proc.supportsAnswer(ep.Renderer); ok {
+			return answer, nil
+		}
+		answer, err := probeSupports(inv, ep.Renderer)
+		if err != nil {
+			return supportsAnswer{}, err
+		}
+		proc.rememberSupports(ep.Renderer, answer)
+		return answer, nil
+	}
+	if ep.Supports == nil {
+		return probeSupports(inv, ep.Renderer)
+	}
+
+	key := inv.key() + "\x00" + ep.Renderer
+	ep.Supports.mu.Lock()
+	defer ep.Supports.mu.Unlock()
+	if answer, ok := ep.Supports.answers[key]; ok {
+		return answer, nil
+	}
+	answer, err := probeSupports(inv, ep.Renderer)
+	if err != nil {
+		return supportsAnswer{}, err
+	}
+	ep.Supports.answers[key] = answer
+	return answer, nil
+}
+
+// probeSupports runs `<command> supports <renderer>`, bounded by the preprocessor's timeout
+func probeSupports(inv *invocation, renderer string) (supportsAnswer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), inv.timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := inv.command(ctx, "supports", renderer)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return supportsAnswer{supported: true}, nil
+	case ctx.Err() != nil:
+		return supportsAnswer{}, fmt.Errorf("supports check timed out after %s", inv.timeout)
+	case errors.As(err, &exitErr):
+		reason := "exited with " + exitErr.Error()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			reason += "\nstderr: " + msg
+		}
+		return supportsAnswer{reason: reason}, nil
+	default:
+		return supportsAnswer{}, fmt.Errorf("failed to run supports check: %w", err)
+	}
+}
@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+)
+
+// TestSupportsHelperProcess is the preprocessor started by TestSupportsProbe. It only
+// supports the html renderer and logs every probe to GEOPUB_TEST_PROBE_LOG.
+func TestSupportsHelperProcess(t *testing.T) {
+	logPath := os.Getenv("GEOPUB_TEST_PROBE_LOG")
+	if logPath == "" {
+		return
+	}
+	args := os.Args
+	if len(args) >= 2 && args[len(args)-2] == "supports" {
+		renderer := args[len(args)-1]
+		f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		fmt.Fprintln(f, renderer)
+		f.Close()
+		if renderer == "html" {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "no %s here\n", renderer)
+		os.Exit(1)
+	}
+
+	data, _ := io.ReadAll(os.Stdin)
+	ctx, err := UnmarshalContext(data)
+	if err != nil {
+		os.Exit(2)
+	}
+	ctx.Book.Sections[0].Chapter.Content += " processed"
+	out, _ := json.Marshal(ctx)
+	os.Stdout.Write(out)
+	os.Exit(0)
+}
+
+func TestSupportsProbe(t *testing.T) {
+	logPath := t.TempDir() + "/probes.log"
+	t.Setenv("GEOPUB_TEST_PROBE_LOG", logPath)
+	cfg, err := config.LoadFromString(fmt.Sprintf(`
+[book]
+title = "Test"
+
+[preprocessor.probed]
+command = %q
+`, os.Args[0]+" -test.run=^TestSupportsHelperProcess$"))
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+
+	cache := NewSupportsCache()
+	run := func(renderer string) string {
+		book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "text", "one.md", nil)})
+		r := NewRunner(cfg, renderer)
+		r.SetSupportsCache(cache)
+		if err := r.Run(book); err != nil {
+			t.Fatalf("Run(%s) error: %v", renderer, err)
+		}
+		return book.Items[0].(*models.Chapter).Content
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if got := run("html"); got != "text processed" {
+		t.Errorf("html should be preprocessed, got %q", got)
+	}
+	if got := run("epub"); got != "text" {
+		t.Errorf("epub should be skipped, got %q", got)
+	}
+	run("html")
+
+	// Skipping is never silent, since a filter may decline by failing on the probe
+	if w := logs.String(); !strings.Contains(w, "skipping preprocessor 'probed' for renderer 'epub'") ||
+		!strings.Contains(w, "stderr: no epub here") || !strings.Contains(w, "supports-check = false") {
+		t.Errorf("expected a warning with the probe's stderr, got %q", w)
+	}
+
+	// Each renderer is probed once per build
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	if probes := strings.Fields(string(data)); strings.Join(probes, ",") != "html,epub" {
+		t.Errorf("expected one probe per renderer, got %v", probes)
+	}
+}
+
+func TestSupportsCheckDisabled(t *testing.T) {
+	logPath := t.TempDir() + "/probes.log"
+	t.Setenv("GEOPUB_TEST_PROBE_LOG", logPath)
+	cfg, err := config.LoadFromString(fmt.Sprintf(`
+[book]
+title = "Test"
+
+[preprocessor.unprobed]
+command = %q
+supports-check = false
+`, os.Args[0]+" -test.run=^TestSupportsHelperProcess$"))
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+	if _, ok := cfg.GetPreprocessorConfigs()["unprobed"].Extra["supports-check"]; ok {
+		t.Errorf("supports-check should not be passed on as an extra option")
+	}
+
+	book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "text", "one.md", nil)})
+	if err := NewRunner(cfg, "epub").Run(book); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := book.Items[0].(*models.Chapter).Content; got != "text processed" {
+		t.Errorf("epub should be preprocessed without asking, got %q", got)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("expected no supports probe, got stat error %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"fmt"
+	"log"
 )
 
 // TopoSort performs a topological sort on preprocessor names based on before/after constraints.
@@ -126,6 +127,23 @@ func ResolvePreprocessorOrder(defaultPreprocessors []string, customPreprocessors
 		}
 	}
 
+	// Like mdBook, ignore constraints on preprocessors that don't run. Built-in and
+	// registered preprocessors are known even when they're disabled, so only other
+	// names get a warning.
+	for _, constraints := range []map[string][]string{before, after} {
+		for name, others := range constraints {
+			kept := []string{}
+			for _, other := range others {
+				if seen[other] {
+					kept = append(kept, other)
+				} else if !isBuiltinPreprocessor(other) {
+					log.Printf("Warning: preprocessor '%s' is ordered against '%s', which is not configured\n", name, other)
+				}
+			}
+			constraints[name] = kept
+		}
+	}
+
 	// Perform topological sort
 	return TopoSort(unique, before, after)
 }
@@ -1,73 +1,32 @@
 // Package sdk provides helpers for developing GeoPub preprocessors in Go.
 //
-// Example usage:
-//
-//	package main
-//
-//	import (
-//		"log"
-//		"github.com/geocine/geopub/internal/preprocessor/sdk"
-//		"github.com/geocine/geopub/internal/preprocessor/runner"
-//	)
-//
-//	func main() {
-//		ctx, err := sdk.ReadContext()
-//		if err != nil {
-//			log.Fatal(err)
-//		}
-//
-//		// Modify ctx.Book here
-//		// For example, replace tokens in chapter content
-//		for _, section := range ctx.Book.Sections {
-//			if section.Chapter != nil {
-//				// Transform the chapter...
-//			}
-//		}
-//
-//		if err := sdk.WriteContext(ctx); err != nil {
-//			log.Fatal(err)
-//		}
-//	}
+// Deprecated: this package is internal to GeoPub and can't be imported by other
+// modules. Use github.com/geocine/geopub/pkg/preprocessor instead.
 package sdk
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
 	"os"
 
 	"github.com/geocine/geopub/internal/preprocessor/runner"
+	"github.com/geocine/geopub/pkg/preprocessor"
 )
 
 // ReadContext reads a preprocessor context from stdin
 // Returns the parsed PreprocessorContext
 func ReadContext() (*runner.PreprocessorContext, error) {
-	data, err := io.ReadAll(os.Stdin)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read stdin: %w", err)
-	}
-
-	ctx, err := runner.UnmarshalContext(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal context: %w", err)
-	}
-
-	return ctx, nil
+	return preprocessor.ReadContext(os.Stdin)
 }
 
 // WriteContext writes a preprocessor context to stdout
 // This is what will be read by GeoPub to apply mutations
 func WriteContext(ctx *runner.PreprocessorContext) error {
-	data, err := json.Marshal(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to marshal context: %w", err)
-	}
-
-	if _, err := os.Stdout.Write(data); err != nil {
-		return fmt.Errorf("failed to write stdout: %w", err)
-	}
+	return preprocessor.WriteContext(os.Stdout, ctx)
+}
 
-	return nil
+// Run reads the context from stdin, lets process modify it and writes it to stdout.
+// See preprocessor.Run.
+func Run(process func(ctx *runner.PreprocessorContext) error) error {
+	return preprocessor.Run(process)
 }
 
 // Helper function to replace tokens in all chapter content
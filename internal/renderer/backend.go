@@ -0,0 +1,65 @@
+package renderer
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/geocine/geopub/internal/config"
+)
+
+// Renderer is an output backend that turns a preprocessed book into files under ctx.DestDir
+type Renderer interface {
+	// Name returns the backend name as used in [output.<name>]
+	Name() string
+	// Render writes the output for ctx.Book into ctx.DestDir
+	Render(ctx *RenderContext) error
+}
+
+// backends maps a backend name to a constructor for it
+var backends = map[string]func() Renderer{
+	"html":     func() Renderer { return NewHtmlRenderer() },
+	"epub":     func() Renderer { return NewEpubRenderer() },
+	"markdown": func() Renderer { return NewMarkdownRenderer() },
+	"json":     func() Renderer { return NewJsonRenderer() },
+	"pdf":      func() Renderer { return NewPdfRenderer() },
+	"man":      func() Renderer { return NewManRenderer() },
+}
+
+// RegisterBackend registers a renderer constructor under the given name,
+// replacing any existing backend with the same name
+func RegisterBackend(name string, factory func() Renderer) {
+	backends[name] = factory
+}
+
+// NewBackend creates the renderer for an [output.<name>] table.
+// A table with a command always uses the external renderer; otherwise the registered
+// backend is used, falling back to an external "geopub-<name>" command.
+func NewBackend(name string, cfg *config.Config) Renderer {
+	if cfg.GetString("output."+name+".command", "") != "" {
+		return NewExternalRenderer(name)
+	}
+	if factory, ok := backends[name]; ok {
+		return factory()
+	}
+	return NewExternalRenderer(name)
+}
+
+// BackendNames returns the names of all registered backends in sorted order
+func BackendNames() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DestDirFor returns the output directory for a backend.
+// With a single configured backend the output goes straight into buildDir (mdBook parity);
+// with several, each backend writes into <buildDir>/<name>/.
+func DestDirFor(buildDir, name string, outputs []string) string {
+	if len(outputs) <= 1 {
+		return buildDir
+	}
+	return filepath.Join(buildDir, name)
+}
@@ -0,0 +1,310 @@
+package renderer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/geocine/geopub/internal/preprocessor/runner"
+)
+
+// buildCacheVersion is bumped whenever rendering changes in a way that invalidates cached outputs
+const buildCacheVersion = 1
+
+// BuildCache remembers the hash of the inputs each output file was generated from, so an
+// unchanged output is neither regenerated nor rewritten on the next build.
+// A nil *BuildCache disables caching.
+type BuildCache struct {
+	Version int               `json:"version"`
+	Entries map[string]string `json:"entries"`
+	// Outputs lists, per output directory, the files its last build produced
+	Outputs map[string][]string `json:"outputs,omitempty"`
+
+	path    string // Where Save writes the cache; empty keeps it in memory only
+	mu      sync.Mutex
+	used    map[string]bool
+	written []string
+}
+
+// NewBuildCache returns an empty cache that is saved to path
+func NewBuildCache(path string) *BuildCache {
+	return &BuildCache{Version: buildCacheVersion, Entries: map[string]string{}, path: path, used: map[string]bool{}}
+}
+
+// Clone returns a cache with the same entries for another build, such as one that
+// writes into a copy of the MemFS the entries describe. It is kept in memory only.
+// Cloning a nil cache returns an empty one.
+func (c *BuildCache) Clone() *BuildCache {
+	clone := NewBuildCache("")
+	if c == nil {
+		return clone
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, hash := range c.Entries {
+		clone.Entries[key] = hash
+	}
+	return clone
+}
+
+// LoadBuildCache reads the cache saved at path. A missing, unreadable or outdated cache
+// file yields an empty cache.
+func LoadBuildCache(path string) *BuildCache {
+	c := NewBuildCache(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	var saved BuildCache
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != buildCacheVersion || saved.Entries == nil {
+		return c
+	}
+	c.Entries = saved.Entries
+	c.Outputs = saved.Outputs
+	return c
+}
+
+// Invalidate forgets every entry so each output is regenerated, while still remembering
+// which files the last build produced
+func (c *BuildCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries = map[string]string{}
+}
+
+// PreviousOutputs returns the files the last build produced in dest, relative to it.
+// ok is false if no build of dest is recorded.
+func (c *BuildCache) PreviousOutputs(dest string) (outputs map[string]bool, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files, ok := c.Outputs[filepath.ToSlash(dest)]
+	if !ok {
+		return nil, false
+	}
+	outputs = map[string]bool{}
+	for _, f := range files {
+		outputs[f] = true
+	}
+	return outputs, true
+}
+
+// SetOutputs records the files the current build produced in dest, relative to it
+func (c *BuildCache) SetOutputs(dest string, outputs []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Outputs == nil {
+		c.Outputs = map[string][]string{}
+	}
+	c.Outputs[filepath.ToSlash(dest)] = outputs
+}
+
+// OverlappingOutputs returns the records of other output directories that contain dest
+// or lie inside it, such as the single output directory of a book that has since added
+// a second backend
+func (c *BuildCache) OverlappingOutputs(dest string) map[string][]string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dest = filepath.ToSlash(dest)
+	overlapping := map[string][]string{}
+	for dir, files := range c.Outputs {
+		if dir != dest && (pathWithin(dest, dir) || pathWithin(dir, dest)) {
+			overlapping[dir] = files
+		}
+	}
+	return overlapping
+}
+
+// ForgetOutputs drops the record of the files the last build produced in dest
+func (c *BuildCache) ForgetOutputs(dest string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Outputs, filepath.ToSlash(dest))
+}
+
+// pathWithin reports whether the slash-separated path p is dir or lies below it
+func pathWithin(p, dir string) bool {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(p))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Fresh reports whether the file at outPath was generated from inputs with the given
+// hash and still exists in output. Outputs that start empty reuse the file from the
+// previous build.
+func (c *BuildCache) Fresh(output OutputFS, outPath, hash string) bool {
+	if c == nil {
+		return false
+	}
+	key := filepath.ToSlash(outPath)
+	c.mu.Lock()
+	cached := c.Entries[key] == hash
+	c.mu.Unlock()
+	if !cached {
+		return false
+	}
+
+	if r, ok := output.(outputReuser); ok {
+		if err := r.Reuse(outPath); err != nil {
+			return false
+		}
+	} else if _, err := output.Stat(outPath); err != nil {
+		return false
+	}
+	c.mu.Lock()
+	c.used[key] = true
+	c.mu.Unlock()
+	return true
+}
+
+// Record stores the input hash of a freshly written output
+func (c *BuildCache) Record(outPath, hash string) {
+	if c == nil {
+		return
+	}
+	key := filepath.ToSlash(outPath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[key] = hash
+	c.used[key] = true
+	c.written = append(c.written, outPath)
+}
+
+// Written returns the outputs recorded since the cache was loaded, i.e. the files the
+// current build actually wrote
+func (c *BuildCache) Written() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	written := append([]string(nil), c.written...)
+	sort.Strings(written)
+	return written
+}
+
+// Save writes the cache file, keeping only entries for outputs of the current build.
+// Backends that recorded nothing and produced no output leave no cache file behind.
+func (c *BuildCache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.Entries {
+		if !c.used[key] {
+			delete(c.Entries, key)
+		}
+	}
+	if c.path == "" {
+		return nil
+	}
+	if len(c.Entries) == 0 && len(c.Outputs) == 0 {
+		if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove build cache: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal build cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create build cache directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write build cache: %w", err)
+	}
+	return nil
+}
+
+// writeCached writes content to out unless the cache shows it already holds that content
+func writeCached(ctx *RenderContext, out string, content []byte) error {
+	hash := hashInputs(string(content))
+	if ctx.Cache.Fresh(ctx.output(), out, hash) {
+		return nil
+	}
+	if err := ctx.output().WriteFile(out, content); err != nil {
+		return err
+	}
+	ctx.Cache.Record(out, hash)
+	return nil
+}
+
+// hashInputs returns a hex digest of the given parts
+func hashInputs(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%d:%s", len(p), p)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// pageInputsHash digests everything a page depends on besides its own content: the
+// config, the Handlebars templates (built-in and theme/ overrides), fingerprinted asset
+// names, the live reload endpoint and the base path
+func pageInputsHash(ctx *RenderContext) string {
+	cfg, _ := json.Marshal(runner.ConfigToJson(ctx.Config))
+	resources, _ := json.Marshal(ctx.ResourceMap)
+	return hashInputs(
+		fmt.Sprint(buildCacheVersion),
+		string(cfg),
+		templatesHash(ctx),
+		string(resources),
+		ctx.LiveReloadEndpointPath,
+		ctx.BasePath,
+	)
+}
+
+// templatesHash digests the template files pages are rendered from. Only the Handlebars
+// files of a theme count, so editing its stylesheets doesn't regenerate every page.
+func templatesHash(ctx *RenderContext) string {
+	var tmplFS fs.FS
+	base := "frontend/templates"
+	if ctx.AssetsFS != nil {
+		tmplFS = ctx.AssetsFS
+	} else {
+		tmplFS = os.DirFS(".")
+	}
+
+	var parts []string
+	collect := func(fsys fs.FS, root, ext string) {
+		var files []string
+		fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, ext) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		sort.Strings(files)
+		for _, f := range files {
+			data, err := fs.ReadFile(fsys, f)
+			if err == nil {
+				parts = append(parts, f, string(data))
+			}
+		}
+	}
+	collect(tmplFS, base, "")
+	// Theme overrides are read from the book root
+	collect(os.DirFS(ctx.themeDir()), ".", ".hbs")
+	return hashInputs(parts...)
+}
@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, ".geopub-cache", "html.json")
+	out := filepath.Join(dir, "page.html")
+	stale := filepath.Join(dir, "gone.html")
+	testutil.WriteFile(t, dir, "page.html", "x")
+	testutil.WriteFile(t, dir, "gone.html", "x")
+
+	c := LoadBuildCache(cachePath)
+	assert.False(t, c.Fresh(DiskFS, out, "h1"))
+	c.Record(out, "h1")
+	c.Record(stale, "h1")
+	require.NoError(t, c.Save())
+
+	c = LoadBuildCache(cachePath)
+	assert.True(t, c.Fresh(DiskFS, out, "h1"))
+	assert.False(t, c.Fresh(DiskFS, out, "h2"))
+	// Entries not used by a build are dropped on save
+	require.NoError(t, c.Save())
+	c = LoadBuildCache(cachePath)
+	assert.False(t, c.Fresh(DiskFS, stale, "h1"))
+
+	// Deleted outputs are never fresh
+	require.NoError(t, os.Remove(out))
+	assert.False(t, c.Fresh(DiskFS, out, "h1"))
+
+	// A nil cache disables caching
+	var none *BuildCache
+	assert.False(t, none.Fresh(DiskFS, out, "h1"))
+	none.Record(out, "h1")
+	assert.NoError(t, none.Save())
+}
+
+func TestBuildCacheSkipsUnchangedChapters(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	testutil.WriteFile(t, root, filepath.Join("src", "img.txt"), "asset")
+	out := filepath.Join(root, "book")
+	cachePath := filepath.Join(root, ".geopub-cache", "html.json")
+
+	one := models.NewChapter("One", "# One", "one.md", nil)
+	two := models.NewChapter("Two", "# Two", "two.md", nil)
+	render := func(cache *BuildCache) {
+		ctx := &RenderContext{
+			Root:      root,
+			DestDir:   out,
+			Book:      models.NewBookWithItems([]models.BookItem{one, two}),
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Cache:     cache,
+		}
+		require.NoError(t, NewHtmlRenderer().Render(ctx))
+		require.NoError(t, cache.Save())
+	}
+
+	render(LoadBuildCache(cachePath))
+	assert.FileExists(t, cachePath)
+
+	// Mark the outputs so we can tell whether they are rewritten
+	for _, f := range []string{"one.html", "two.html", "img.txt", filepath.Join("css", "general.css")} {
+		testutil.WriteFile(t, out, f, "unchanged")
+	}
+
+	two.Content = "# Two\n\nEdited."
+	cache := LoadBuildCache(cachePath)
+	render(cache)
+	assert.Equal(t, "unchanged", testutil.ReadFile(t, out, "one.html"))
+	assert.Equal(t, "unchanged", testutil.ReadFile(t, out, "img.txt"))
+	assert.Equal(t, "unchanged", testutil.ReadFile(t, out, filepath.Join("css", "general.css")))
+	assert.Contains(t, testutil.ReadFile(t, out, "two.html"), "Edited.")
+
+	// Only the outputs that changed are reported as written
+	var written []string
+	for _, p := range cache.Written() {
+		rel, err := filepath.Rel(out, p)
+		require.NoError(t, err)
+		written = append(written, filepath.ToSlash(rel))
+	}
+	assert.Equal(t, []string{"print.html", "searchindex.js", "two.html"}, written)
+
+	// A fresh cache (--force) regenerates everything
+	render(NewBuildCache(cachePath))
+	assert.Contains(t, testutil.ReadFile(t, out, "one.html"), "<h1")
+	assert.Equal(t, "asset", testutil.ReadFile(t, out, "img.txt"))
+}
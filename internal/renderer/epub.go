@@ -0,0 +1,477 @@
+package renderer
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geocine/geopub/internal/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubStylesheet is the default stylesheet packaged into every EPUB
+const epubStylesheet = `body { font-family: serif; line-height: 1.5; }
+h1, h2, h3, h4, h5, h6 { font-family: sans-serif; }
+a.header { color: inherit; text-decoration: none; }
+pre, code { font-family: monospace; }
+pre { white-space: pre-wrap; }
+img { max-width: 100%; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.2em 0.5em; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 3px solid #ccc; }
+`
+
+// epubMediaTypes maps file extensions of source assets to EPUB core media types.
+// Files with other extensions are not packaged.
+var epubMediaTypes = map[string]string{
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".svg":   "image/svg+xml",
+	".webp":  "image/webp",
+	".css":   "text/css",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// EpubRenderer renders a book to a single EPUB 3 file.
+//
+// Settings are read from [output.epub]:
+//
+//	[output.epub]
+//	filename = "my-book.epub"    # default: slugified book title
+//	cover-image = "images/cover.png" # relative to the source directory
+//	stylesheet = "theme/epub.css"    # relative to the book root, replaces the default
+type EpubRenderer struct {
+	html *HtmlRenderer
+}
+
+// NewEpubRenderer creates a new EPUB renderer
+func NewEpubRenderer() *EpubRenderer {
+	return &EpubRenderer{html: NewHtmlRenderer()}
+}
+
+// Name returns the renderer name
+func (r *EpubRenderer) Name() string {
+	return "epub"
+}
+
+// epubChapter is a chapter converted for packaging
+type epubChapter struct {
+	id       string
+	href     string // relative to OEBPS/
+	chapter  *models.Chapter
+	headings []HeadingInfo
+}
+
+// epubResource is a non-chapter file listed in the manifest
+type epubResource struct {
+	id         string
+	href       string
+	mediaType  string
+	properties string
+	data       []byte
+}
+
+// Render packages the book as an EPUB file in ctx.DestDir
+func (r *EpubRenderer) Render(ctx *RenderContext) error {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Convert chapters in reading order
+	var chapters []*epubChapter
+	files := map[string][]byte{}
+	for i, ch := range r.html.collectChapters(ctx.Book) {
+		if ch.Path == nil {
+			continue
+		}
+		htmlContent, headings := r.html.convertMarkdown(ch.Content)
+		href := filepath.ToSlash(strings.TrimSuffix(*ch.Path, ".md") + ".xhtml")
+		chapters = append(chapters, &epubChapter{
+			id:       fmt.Sprintf("chapter-%d", i+1),
+			href:     href,
+			chapter:  ch,
+			headings: headings,
+		})
+		xhtml, err := r.chapterXHTML(ctx, ch, href, htmlContent)
+		if err != nil {
+			return fmt.Errorf("failed to convert chapter '%s' to XHTML: %w", *ch.Path, err)
+		}
+		files[href] = []byte(xhtml)
+	}
+
+	// Stylesheet
+	stylesheet := []byte(epubStylesheet)
+	if custom := ctx.Config.GetString("output.epub.stylesheet", ""); custom != "" {
+		data, err := os.ReadFile(filepath.Join(ctx.Root, custom))
+		if err != nil {
+			return fmt.Errorf("failed to read epub stylesheet: %w", err)
+		}
+		stylesheet = data
+	}
+	resources := []*epubResource{{id: "style", href: "geopub.css", mediaType: "text/css", data: stylesheet}}
+
+	// Images and other assets from the source directory
+	coverImage := filepath.ToSlash(ctx.Config.GetString("output.epub.cover-image", ""))
+	destClean := filepath.Clean(ctx.DestDir)
+	err := walkNonMarkdown(ctx.SourceDir, func(rel, path string) error {
+		// Don't package the build output if it lives inside the source tree
+		if strings.HasPrefix(filepath.Clean(path), destClean+string(os.PathSeparator)) {
+			return nil
+		}
+		mediaType, ok := epubMediaTypes[strings.ToLower(filepath.Ext(rel))]
+		if !ok {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		res := &epubResource{
+			id:        fmt.Sprintf("asset-%d", len(resources)),
+			href:      filepath.ToSlash(rel),
+			mediaType: mediaType,
+			data:      data,
+		}
+		if res.href == coverImage {
+			res.properties = "cover-image"
+		}
+		resources = append(resources, res)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to collect source assets: %w", err)
+	}
+	for _, res := range resources {
+		files[res.href] = res.data
+	}
+
+	files["nav.xhtml"] = []byte(r.navXHTML(ctx, chapters))
+	files["content.opf"] = []byte(r.packageOPF(ctx, chapters, resources))
+
+	return r.writeArchive(ctx.output(), filepath.Join(ctx.DestDir, r.filename(ctx)), files)
+}
+
+// filename returns the EPUB file name from config or the book title
+func (r *EpubRenderer) filename(ctx *RenderContext) string {
+	if name := ctx.Config.GetString("output.epub.filename", ""); name != "" {
+		return name
+	}
+	if slug := slugify(ctx.Config.Book.Title); slug != "" {
+		return slug + ".epub"
+	}
+	return "book.epub"
+}
+
+// writeArchive writes the OCF container. The mimetype entry must come first and be stored uncompressed.
+func (r *EpubRenderer) writeArchive(out OutputFS, outPath string, files map[string][]byte) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("application/epub+zip")); err != nil {
+		return err
+	}
+
+	writeEntry := func(name string, data []byte) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	container := `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+	if err := writeEntry("META-INF/container.xml", []byte(container)); err != nil {
+		return err
+	}
+
+	// Keep the OEBPS entries in a stable order: package and nav first, then the rest sorted
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != "content.opf" && name != "nav.xhtml" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range append([]string{"content.opf", "nav.xhtml"}, names...) {
+		if err := writeEntry("OEBPS/"+name, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := out.WriteFile(outPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write epub: %w", err)
+	}
+	return nil
+}
+
+// chapterXHTML wraps converted chapter HTML in an XHTML content document
+func (r *EpubRenderer) chapterXHTML(ctx *RenderContext, ch *models.Chapter, href, htmlContent string) (string, error) {
+	body, err := toXHTML(htmlContent)
+	if err != nil {
+		return "", err
+	}
+	depth := strings.Count(href, "/")
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString("<!DOCTYPE html>\n")
+	lang := htmlEscape(epubLanguage(ctx))
+	fmt.Fprintf(&b, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">`+"\n", lang, lang)
+	b.WriteString("<head>\n")
+	b.WriteString(`<meta charset="UTF-8" />` + "\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", htmlEscape(ch.Name))
+	fmt.Fprintf(&b, `<link rel="stylesheet" type="text/css" href="%sgeopub.css" />`+"\n", strings.Repeat("../", depth))
+	b.WriteString("</head>\n<body>\n")
+	b.WriteString(body)
+	b.WriteString("\n</body>\n</html>\n")
+	return b.String(), nil
+}
+
+// navXHTML builds the EPUB navigation document from the book structure and chapter headings
+func (r *EpubRenderer) navXHTML(ctx *RenderContext, chapters []*epubChapter) string {
+	byChapter := map[*models.Chapter]*epubChapter{}
+	for _, ec := range chapters {
+		byChapter[ec.chapter] = ec
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString("<!DOCTYPE html>\n")
+	lang := htmlEscape(epubLanguage(ctx))
+	fmt.Fprintf(&b, `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">`+"\n", lang, lang)
+	fmt.Fprintf(&b, "<head>\n<meta charset=\"UTF-8\" />\n<title>%s</title>\n</head>\n<body>\n", htmlEscape(ctx.Config.Book.Title))
+	b.WriteString(`<nav epub:type="toc" id="toc">` + "\n")
+	b.WriteString("<h1>Table of Contents</h1>\n<ol>\n")
+
+	// Chapters following a part title are nested under it. A span must be followed by a
+	// non-empty list, so parts without chapters are left out.
+	var part *models.PartTitle
+	var partItems strings.Builder
+	closePart := func() {
+		if part != nil && partItems.Len() > 0 {
+			fmt.Fprintf(&b, "<li><span>%s</span><ol>\n%s</ol></li>\n", htmlEscape(part.Title), partItems.String())
+		}
+		partItems.Reset()
+	}
+	for _, item := range ctx.Book.Items {
+		switch v := item.(type) {
+		case *models.PartTitle:
+			closePart()
+			part = v
+		case *models.Chapter:
+			if part != nil {
+				r.writeNavChapter(&partItems, v, byChapter)
+			} else {
+				r.writeNavChapter(&b, v, byChapter)
+			}
+		}
+	}
+	closePart()
+
+	b.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return b.String()
+}
+
+// writeNavChapter writes a chapter entry with its second-level headings and sub-chapters
+func (r *EpubRenderer) writeNavChapter(b *strings.Builder, ch *models.Chapter, byChapter map[*models.Chapter]*epubChapter) {
+	ec, ok := byChapter[ch]
+	if !ok {
+		return
+	}
+
+	var children strings.Builder
+	for _, h := range ec.headings {
+		if h.Level == "2" {
+			fmt.Fprintf(&children, "<li><a href=\"%s#%s\">%s</a></li>\n", ec.href, h.ID, htmlEscape(h.Text))
+		}
+	}
+	for _, item := range ch.SubItems {
+		if subCh, ok := item.(*models.Chapter); ok {
+			r.writeNavChapter(&children, subCh, byChapter)
+		}
+	}
+
+	fmt.Fprintf(b, "<li><a href=\"%s\">%s</a>", ec.href, htmlEscape(ch.Name))
+	if children.Len() > 0 {
+		b.WriteString("<ol>\n")
+		b.WriteString(children.String())
+		b.WriteString("</ol>")
+	}
+	b.WriteString("</li>\n")
+}
+
+// packageOPF builds the package document with metadata, manifest and spine
+func (r *EpubRenderer) packageOPF(ctx *RenderContext, chapters []*epubChapter, resources []*epubResource) string {
+	book := ctx.Config.Book
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">` + "\n")
+	b.WriteString(`<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	fmt.Fprintf(&b, "<dc:identifier id=\"book-id\">%s</dc:identifier>\n", htmlEscape(epubIdentifier(ctx)))
+	fmt.Fprintf(&b, "<dc:title>%s</dc:title>\n", htmlEscape(book.Title))
+	fmt.Fprintf(&b, "<dc:language>%s</dc:language>\n", htmlEscape(epubLanguage(ctx)))
+	for _, author := range book.Authors {
+		fmt.Fprintf(&b, "<dc:creator>%s</dc:creator>\n", htmlEscape(author))
+	}
+	if book.Description != "" {
+		fmt.Fprintf(&b, "<dc:description>%s</dc:description>\n", htmlEscape(book.Description))
+	}
+	fmt.Fprintf(&b, "<meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	b.WriteString("</metadata>\n")
+
+	b.WriteString("<manifest>\n")
+	b.WriteString(`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>` + "\n")
+	for _, ec := range chapters {
+		fmt.Fprintf(&b, "<item id=\"%s\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", ec.id, htmlEscape(ec.href))
+	}
+	for _, res := range resources {
+		if res.properties != "" {
+			fmt.Fprintf(&b, "<item id=\"%s\" href=\"%s\" media-type=\"%s\" properties=\"%s\"/>\n", res.id, htmlEscape(res.href), res.mediaType, res.properties)
+		} else {
+			fmt.Fprintf(&b, "<item id=\"%s\" href=\"%s\" media-type=\"%s\"/>\n", res.id, htmlEscape(res.href), res.mediaType)
+		}
+	}
+	b.WriteString("</manifest>\n")
+
+	b.WriteString("<spine>\n")
+	for _, ec := range chapters {
+		fmt.Fprintf(&b, "<itemref idref=\"%s\"/>\n", ec.id)
+	}
+	b.WriteString("</spine>\n</package>\n")
+	return b.String()
+}
+
+// epubLanguage returns the book language, defaulting to English
+func epubLanguage(ctx *RenderContext) string {
+	if ctx.Config.Book.Language != "" {
+		return ctx.Config.Book.Language
+	}
+	return "en"
+}
+
+// epubIdentifier returns [output.epub] identifier, or a stable urn:uuid derived from title and authors
+func epubIdentifier(ctx *RenderContext) string {
+	if id := ctx.Config.GetString("output.epub.identifier", ""); id != "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(ctx.Config.Book.Title + "\x00" + strings.Join(ctx.Config.Book.Authors, "\x00")))
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// xhtmlLinkRegex matches relative links to rendered chapter pages
+var xhtmlLinkRegex = regexp.MustCompile(`^([^#:]+)\.html(#.*)?$`)
+
+// xhtmlNamespaces are declared on the root of embedded foreign content
+var xhtmlNamespaces = map[string]string{
+	"svg":  `xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"`,
+	"math": `xmlns="http://www.w3.org/1998/Math/MathML"`,
+}
+
+// toXHTML parses renderer HTML, including raw HTML from chapters, the way a browser
+// would and serializes it as well-formed XHTML: unclosed elements are closed, attribute
+// values are quoted, void elements are self-closed, inline SVG and MathML get their
+// namespaces and intra-book .html links point at .xhtml files
+func toXHTML(src string) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(src), body)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		writeXHTML(&b, n, "")
+	}
+	return b.String(), nil
+}
+
+// writeXHTML serializes n as XHTML; parentNS is the namespace of its parent element
+func writeXHTML(b *strings.Builder, n *html.Node, parentNS string) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(xmlEscape(n.Data, false))
+	case html.CommentNode:
+		// "--" may not appear inside an XML comment
+		fmt.Fprintf(b, "<!--%s-->", strings.ReplaceAll(n.Data, "--", "- -"))
+	case html.ElementNode:
+		b.WriteString("<" + n.Data)
+		if n.Namespace != parentNS && xhtmlNamespaces[n.Namespace] != "" {
+			b.WriteString(" " + xhtmlNamespaces[n.Namespace])
+		}
+		for _, a := range n.Attr {
+			name := a.Key
+			if a.Namespace != "" {
+				name = a.Namespace + ":" + a.Key
+			}
+			if name == "xmlns" || name == "xmlns:xlink" || !isXMLName(name) {
+				continue
+			}
+			val := a.Val
+			if a.Key == "href" && a.Namespace == "" && n.Namespace == "" {
+				val = xhtmlLinkRegex.ReplaceAllString(val, "$1.xhtml$2")
+			}
+			fmt.Fprintf(b, ` %s="%s"`, name, xmlEscape(val, true))
+		}
+		if n.FirstChild == nil && (n.Namespace != "" || xhtmlVoidElements[n.Data]) {
+			b.WriteString(" />")
+			return
+		}
+		b.WriteString(">")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeXHTML(b, c, n.Namespace)
+		}
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+// xhtmlVoidElements never have content and are written self-closed
+var xhtmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// xmlEscape escapes text for XML character data, or for a double-quoted attribute value
+func xmlEscape(s string, attr bool) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	if attr {
+		r = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	}
+	return r.Replace(s)
+}
+
+// isXMLName reports whether an attribute name parsed from HTML is also a valid XML name
+func isXMLName(name string) bool {
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':', c >= 0x80:
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return name != "" && strings.Count(name, ":") <= 1
+}
@@ -0,0 +1,145 @@
+package renderer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpubRender(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	testutil.WriteFile(t, root, filepath.Join("src", "images", "cover.png"), "png")
+	testutil.WriteFile(t, root, filepath.Join("src", "notes.txt"), "not packaged")
+
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Title = "Offline Book"
+	cfg.Book.Authors = []string{"Jane Doe"}
+	cfg.Book.Description = "Read anywhere"
+	cfg.Output["epub"] = map[string]interface{}{"cover-image": "images/cover.png"}
+
+	intro := models.NewChapter("Introduction", "# Introduction\n\n## Getting Started\n\nSee [one](guide/one.md).<br>\n", "intro.md", nil)
+	one := models.NewChapter("One", "# One\n\n![cover](../images/cover.png)\n", "guide/one.md", nil)
+	one.Number = &models.SectionNumber{Parts: []int{1}}
+	book := models.NewBookWithItems([]models.BookItem{
+		intro,
+		&models.PartTitle{Title: "Guide"},
+		one,
+		models.NewDraftChapter("Later", nil),
+	})
+
+	out := t.TempDir()
+	ctx := &RenderContext{Root: root, DestDir: out, Book: book, Config: cfg, SourceDir: filepath.Join(root, "src")}
+	require.NoError(t, NewEpubRenderer().Render(ctx))
+
+	zr, err := zip.OpenReader(filepath.Join(out, "offline-book.epub"))
+	require.NoError(t, err)
+	defer zr.Close()
+
+	// mimetype must be the first, uncompressed entry
+	require.NotEmpty(t, zr.File)
+	assert.Equal(t, "mimetype", zr.File[0].Name)
+	assert.Equal(t, zip.Store, zr.File[0].Method)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = string(data)
+	}
+
+	assert.Contains(t, files["META-INF/container.xml"], `full-path="OEBPS/content.opf"`)
+
+	opf := files["OEBPS/content.opf"]
+	assert.Contains(t, opf, "<dc:title>Offline Book</dc:title>")
+	assert.Contains(t, opf, "<dc:creator>Jane Doe</dc:creator>")
+	assert.Contains(t, opf, "<dc:language>en</dc:language>")
+	assert.Contains(t, opf, "<dc:description>Read anywhere</dc:description>")
+	assert.Contains(t, opf, `href="images/cover.png" media-type="image/png" properties="cover-image"`)
+	assert.Contains(t, opf, `<itemref idref="chapter-1"/>`)
+	assert.NotContains(t, opf, "notes.txt")
+
+	nav := files["OEBPS/nav.xhtml"]
+	assert.Contains(t, nav, `<a href="intro.xhtml#getting-started">Getting Started</a>`)
+	assert.Contains(t, nav, `<li><span>Guide</span><ol>`)
+	assert.Contains(t, nav, `<a href="guide/one.xhtml">One</a>`)
+	assert.NotContains(t, nav, "Later")
+
+	introXHTML := files["OEBPS/intro.xhtml"]
+	assert.Contains(t, introXHTML, `id="getting-started"`)
+	assert.Contains(t, introXHTML, `href="guide/one.xhtml"`)
+	assert.Contains(t, introXHTML, "<br />")
+
+	oneXHTML := files["OEBPS/guide/one.xhtml"]
+	assert.Contains(t, oneXHTML, `href="../geopub.css"`)
+	assert.Contains(t, oneXHTML, `<img src="../images/cover.png" alt="cover" />`)
+	assert.Contains(t, files, "OEBPS/images/cover.png")
+}
+
+func TestEpubNavSkipsEmptyParts(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Title = "Parts"
+
+	book := models.NewBookWithItems([]models.BookItem{
+		&models.PartTitle{Title: "Empty"},
+		&models.PartTitle{Title: "Drafts"},
+		models.NewDraftChapter("Later", nil),
+		&models.PartTitle{Title: "Guide"},
+		models.NewChapter("One", "# One\n", "one.md", nil),
+		&models.PartTitle{Title: "Trailing"},
+	})
+
+	out := t.TempDir()
+	ctx := &RenderContext{Root: root, DestDir: out, Book: book, Config: cfg, SourceDir: filepath.Join(root, "src")}
+	require.NoError(t, NewEpubRenderer().Render(ctx))
+
+	zr, err := zip.OpenReader(filepath.Join(out, "parts.epub"))
+	require.NoError(t, err)
+	defer zr.Close()
+	var nav string
+	for _, f := range zr.File {
+		if f.Name == "OEBPS/nav.xhtml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			require.NoError(t, err)
+			nav = string(data)
+		}
+	}
+
+	assert.Contains(t, nav, "<li><span>Guide</span><ol>\n<li><a href=\"one.xhtml\">One</a></li>\n</ol></li>")
+	assert.NotContains(t, nav, "Empty")
+	assert.NotContains(t, nav, "Drafts")
+	assert.NotContains(t, nav, "Trailing")
+	assert.NotContains(t, nav, "<ol>\n</ol>")
+	assert.NoError(t, xml.Unmarshal([]byte(nav), new(struct{})))
+}
+
+func TestToXHTML(t *testing.T) {
+	in := `<p>a&nbsp;b &amp; <a href="ch1.html#x">c</a> <a href="https://example.com/page.html">d</a><br></p><hr>`
+	got, err := toXHTML(in)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>a\u00a0b &amp; <a href=\"ch1.xhtml#x\">c</a> <a href=\"https://example.com/page.html\">d</a><br /></p><hr />", got)
+
+	svg, err := toXHTML(`<svg viewbox="0 0 16 16" width="18"><path d="M0"></path></svg>`)
+	require.NoError(t, err)
+	assert.Equal(t, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 16 16" width="18"><path d="M0" /></svg>`, svg)
+
+	// Raw HTML from chapters: unquoted and boolean attributes, unclosed elements
+	raw, err := toXHTML("<img src=a.png alt=x><details open><summary>More</summary><p>one<p>two</details>")
+	require.NoError(t, err)
+	assert.Equal(t, `<img src="a.png" alt="x" /><details open=""><summary>More</summary><p>one</p><p>two</p></details>`, raw)
+	assert.NoError(t, xml.Unmarshal([]byte("<body>"+raw+"</body>"), new(struct{})))
+}
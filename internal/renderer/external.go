@@ -0,0 +1,113 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/geocine/geopub/internal/preprocessor/runner"
+)
+
+// ExternalRenderContext is the JSON structure sent to external renderers on stdin
+// It matches the mdBook renderer protocol
+type ExternalRenderContext struct {
+	Version     string                 `json:"version"`
+	Root        string                 `json:"root"`
+	Book        *runner.JsonBook       `json:"book"`
+	Config      map[string]interface{} `json:"config"`
+	Destination string                 `json:"destination"`
+}
+
+// ExternalRenderer runs an external command as an output backend.
+// The command is taken from [output.<name>] command, defaulting to "geopub-<name>" on PATH.
+// It receives an ExternalRenderContext on stdin and runs with the destination directory as
+// its working directory.
+type ExternalRenderer struct {
+	name string
+}
+
+// NewExternalRenderer creates an external renderer for the [output.<name>] table
+func NewExternalRenderer(name string) *ExternalRenderer {
+	return &ExternalRenderer{name: name}
+}
+
+// Name returns the renderer name
+func (r *ExternalRenderer) Name() string {
+	return r.name
+}
+
+// Render spawns the external command and feeds it the render context
+func (r *ExternalRenderer) Render(ctx *RenderContext) error {
+	if ctx.output() != DiskFS {
+		return fmt.Errorf("renderer '%s' runs an external command and can only write to disk", r.name)
+	}
+	command := ctx.Config.GetString("output."+r.name+".command", "")
+	if command == "" {
+		command = fmt.Sprintf("geopub-%s", r.name)
+	}
+
+	renderCtx, err := NewExternalRenderContext(ctx)
+	if err != nil {
+		return err
+	}
+	inputJSON, err := json.Marshal(renderCtx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal render context: %w", err)
+	}
+
+	if err := os.MkdirAll(renderCtx.Destination, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Relative paths in the command are resolved against the book root, since the
+	// command itself runs inside the destination directory
+	parts, err := runner.SplitCommand(runner.PrepareWorkingDirectory(command, renderCtx.Root))
+	if err != nil {
+		return fmt.Errorf("renderer '%s' has an invalid command: %w", r.name, err)
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("renderer '%s' has an empty command", r.name)
+	}
+
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Dir = renderCtx.Destination
+	cmd.Stdin = bytes.NewReader(inputJSON)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) && ctx.Config.GetBool("output."+r.name+".optional", false) {
+			log.Printf("Warning: renderer '%s' command '%s' not found; skipping optional renderer", r.name, parts[0])
+			return nil
+		}
+		return fmt.Errorf("renderer '%s' failed: %w", r.name, err)
+	}
+
+	return nil
+}
+
+// NewExternalRenderContext creates the context passed to an external renderer.
+// Root and Destination are made absolute so the command can resolve them from any directory.
+func NewExternalRenderContext(ctx *RenderContext) (*ExternalRenderContext, error) {
+	root, err := filepath.Abs(ctx.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve book root: %w", err)
+	}
+	dest, err := filepath.Abs(ctx.DestDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve destination: %w", err)
+	}
+
+	return &ExternalRenderContext{
+		Version:     "0.1",
+		Root:        root,
+		Book:        runner.BookToJson(ctx.Book),
+		Config:      runner.ConfigToJson(ctx.Config),
+		Destination: dest,
+	}, nil
+}
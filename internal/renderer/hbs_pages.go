@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/aymerick/raymond"
+	"github.com/geocine/geopub/internal/models"
 )
 
 // pageData is the context passed to the Handlebars templates for pages
@@ -41,6 +42,52 @@ type pageData struct {
 	GitRepositoryEditUrl   string                 `json:"git_repository_edit_url"`
 	GitRepositoryIcon      string                 `json:"git_repository_icon"`
 	GitRepositoryIconClass string                 `json:"git_repository_icon_class"`
+	Authors                []string               `json:"authors"`
+	Tags                   []string               `json:"tags"`
+	TagLinks               []tagLink              `json:"tag_links"`
+	Metadata               map[string]any         `json:"metadata"`
+}
+
+// applyChapterMetadata fills the fields of a chapter page that come from its frontmatter:
+// a description overrides the book's, and authors default to the book's
+func (r *HtmlRenderer) applyChapterMetadata(ctx *RenderContext, ch *models.Chapter, pd *pageData) {
+	pd.Metadata = ch.Metadata
+	if description, ok := ch.Metadata["description"].(string); ok && description != "" {
+		pd.Description = description
+	}
+	pd.Authors = metadataStrings(ch.Metadata["authors"])
+	if len(pd.Authors) == 0 {
+		pd.Authors = metadataStrings(ch.Metadata["author"])
+	}
+	if len(pd.Authors) == 0 {
+		pd.Authors = ctx.Config.Book.Authors
+	}
+	pd.Tags = chapterTags(ch)
+	pd.TagLinks = r.chapterTagLinks(ch, pd.PathToRoot)
+}
+
+// chapterTags returns the tags from the frontmatter of a chapter
+func chapterTags(ch *models.Chapter) []string {
+	return metadataStrings(ch.Metadata["tags"])
+}
+
+// metadataStrings reads a frontmatter value that is either a string or a list of strings
+func metadataStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []any:
+		var result []string
+		for _, item := range v {
+			if s := fmt.Sprint(item); s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
 }
 
 // registerCommonHelpers registers helpers used by the templates.
@@ -114,7 +161,7 @@ func renderPageWithHbs(ctx *RenderContext, data *pageData) (string, error) {
 	var base string
 
 	// Check for theme override first
-	themeIndexPath := filepath.Join("theme", "index.hbs")
+	themeIndexPath := filepath.Join(ctx.themeDir(), "index.hbs")
 	if data, err := os.ReadFile(themeIndexPath); err == nil {
 		// Use custom theme template and replace mdbook- with geopub-
 		content := string(data)
@@ -178,7 +225,7 @@ func renderPageWithHbs(ctx *RenderContext, data *pageData) (string, error) {
 	// Helper to read file with theme override support
 	readTemplateFile := func(filename string) ([]byte, error) {
 		// Try theme directory first
-		themePath := filepath.Join("theme", filename)
+		themePath := filepath.Join(ctx.themeDir(), filename)
 		if data, err := os.ReadFile(themePath); err == nil {
 			// Replace mdbook- prefixes with geopub- for compatibility
 			ext := strings.ToLower(filepath.Ext(filename))
@@ -199,16 +246,17 @@ func renderPageWithHbs(ctx *RenderContext, data *pageData) (string, error) {
 		return nil, fmt.Errorf("file not found: %s", filename)
 	}
 
-	// Register partials
+	// Parse the page template
+	tpl, err := raymond.Parse(string(indexData))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	// Register partials on the template itself, so books with different themes don't share them
 	safeRegisterPartial := func(name string, content []byte) {
-		defer func() {
-			if r := recover(); r != nil {
-				// Partial already registered, that's OK
-			}
-		}()
 		if len(content) > 0 {
-			if tmpl, err := raymond.Parse(string(content)); err == nil {
-				raymond.RegisterPartialTemplate(name, tmpl)
+			if partial, err := raymond.Parse(string(content)); err == nil {
+				tpl.RegisterPartialTemplate(name, partial)
 			}
 		}
 	}
@@ -228,12 +276,6 @@ func renderPageWithHbs(ctx *RenderContext, data *pageData) (string, error) {
 		safeRegisterPartial("footer", b)
 	}
 
-	// Parse and render template
-	tpl, err := raymond.Parse(string(indexData))
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
-	}
-
 	// Convert struct to map for proper field name resolution in template
 	dataMap := map[string]interface{}{
 		"language":                  data.Language,
@@ -264,6 +306,10 @@ func renderPageWithHbs(ctx *RenderContext, data *pageData) (string, error) {
 		"git_repository_edit_url":   data.GitRepositoryEditUrl,
 		"git_repository_icon":       data.GitRepositoryIcon,
 		"git_repository_icon_class": data.GitRepositoryIconClass,
+		"authors":                   data.Authors,
+		"tags":                      data.Tags,
+		"tag_links":                 data.TagLinks,
+		"metadata":                  data.Metadata,
 	}
 
 	result, err := tpl.Exec(dataMap)
@@ -0,0 +1,136 @@
+package renderer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/geocine/geopub/internal/models"
+)
+
+// jsonExport is the top-level structure written to book.json
+type jsonExport struct {
+	Title       string           `json:"title"`
+	Authors     []string         `json:"authors"`
+	Description string           `json:"description"`
+	Language    string           `json:"language"`
+	Items       []jsonExportItem `json:"items"`
+}
+
+// jsonExportItem is a part title, separator or chapter in the exported tree
+type jsonExportItem struct {
+	Type        string           `json:"type"` // "chapter", "separator" or "part-title"
+	Title       string           `json:"title,omitempty"`
+	Name        string           `json:"name,omitempty"`
+	Number      string           `json:"number,omitempty"`
+	NumberParts []int            `json:"number_parts,omitempty"`
+	Path        string           `json:"path,omitempty"`
+	HtmlPath    string           `json:"html_path,omitempty"`
+	Draft       bool             `json:"draft,omitempty"`
+	Breadcrumbs []string         `json:"breadcrumbs,omitempty"`
+	Markdown    string           `json:"markdown,omitempty"`
+	Html        string           `json:"html,omitempty"`
+	Headings    []HeadingInfo    `json:"headings,omitempty"`
+	SubItems    []jsonExportItem `json:"sub_items,omitempty"`
+}
+
+// JsonRenderer writes the preprocessed book tree, including rendered HTML and headings,
+// to a single book.json for machine consumption.
+//
+// Settings are read from [output.json]:
+//
+//	[output.json]
+//	filename = "book.json"
+//	pretty = true  # indent the output
+type JsonRenderer struct {
+	html *HtmlRenderer
+}
+
+// NewJsonRenderer creates a new JSON export renderer
+func NewJsonRenderer() *JsonRenderer {
+	return &JsonRenderer{html: NewHtmlRenderer()}
+}
+
+// Name returns the renderer name
+func (r *JsonRenderer) Name() string {
+	return "json"
+}
+
+// Render writes the exported book tree into ctx.DestDir
+func (r *JsonRenderer) Render(ctx *RenderContext) error {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	export := &jsonExport{
+		Title:       ctx.Config.Book.Title,
+		Authors:     ctx.Config.Book.Authors,
+		Description: ctx.Config.Book.Description,
+		Language:    ctx.Config.Book.Language,
+		Items:       r.exportItems(ctx.Book.Items, nil),
+	}
+	if export.Authors == nil {
+		export.Authors = []string{}
+	}
+
+	var data []byte
+	var err error
+	if ctx.Config.GetBool("output.json.pretty", false) {
+		data, err = json.MarshalIndent(export, "", "  ")
+	} else {
+		data, err = json.Marshal(export)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal book: %w", err)
+	}
+
+	filename := ctx.Config.GetString("output.json.filename", "book.json")
+	if err := ctx.output().WriteFile(filepath.Join(ctx.DestDir, filename), data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
+
+// exportItems converts book items recursively, tracking the chapter names above them for breadcrumbs
+func (r *JsonRenderer) exportItems(items []models.BookItem, parents []string) []jsonExportItem {
+	result := []jsonExportItem{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case *models.PartTitle:
+			result = append(result, jsonExportItem{Type: "part-title", Title: v.Title})
+		case *models.Separator:
+			result = append(result, jsonExportItem{Type: "separator"})
+		case *models.Chapter:
+			result = append(result, r.exportChapter(v, parents))
+		}
+	}
+	return result
+}
+
+// exportChapter converts a single chapter, rendering its content to HTML
+func (r *JsonRenderer) exportChapter(ch *models.Chapter, parents []string) jsonExportItem {
+	breadcrumbs := append(append([]string{}, parents...), ch.Name)
+	item := jsonExportItem{
+		Type:        "chapter",
+		Name:        ch.Name,
+		Draft:       ch.IsDraft,
+		Breadcrumbs: breadcrumbs,
+		Markdown:    ch.Content,
+	}
+	if ch.Number != nil && len(ch.Number.Parts) > 0 {
+		parts := make([]string, len(ch.Number.Parts))
+		for i, p := range ch.Number.Parts {
+			parts[i] = fmt.Sprintf("%d", p)
+		}
+		item.Number = strings.Join(parts, ".")
+		item.NumberParts = ch.Number.Parts
+	}
+	if ch.Path != nil {
+		item.Path = filepath.ToSlash(*ch.Path)
+		item.HtmlPath = strings.TrimSuffix(item.Path, ".md") + ".html"
+		item.Html, item.Headings = r.html.convertMarkdown(ch.Content)
+	}
+	item.SubItems = r.exportItems(ch.SubItems, breadcrumbs)
+	return item
+}
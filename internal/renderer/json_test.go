@@ -0,0 +1,58 @@
+package renderer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonRender(t *testing.T) {
+	ch1 := models.NewChapter("Chapter 1", "# Chapter 1\n\n## Overview\n", "ch1.md", nil)
+	ch1.Number = &models.SectionNumber{Parts: []int{1}}
+	sub := models.NewChapter("Details", "# Details", "ch1/details.md", nil)
+	sub.Number = &models.SectionNumber{Parts: []int{1, 2}}
+	ch1.SubItems = append(ch1.SubItems, sub)
+
+	book := models.NewBookWithItems([]models.BookItem{
+		&models.PartTitle{Title: "Basics"},
+		ch1,
+		&models.Separator{},
+		models.NewDraftChapter("Later", nil),
+	})
+
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Title = "Exported"
+	out := t.TempDir()
+	require.NoError(t, NewJsonRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}))
+
+	var export jsonExport
+	require.NoError(t, json.Unmarshal([]byte(testutil.ReadFile(t, out, "book.json")), &export))
+
+	assert.Equal(t, "Exported", export.Title)
+	require.Len(t, export.Items, 4)
+	assert.Equal(t, jsonExportItem{Type: "part-title", Title: "Basics"}, export.Items[0])
+	assert.Equal(t, "separator", export.Items[2].Type)
+
+	chapter := export.Items[1]
+	assert.Equal(t, "chapter", chapter.Type)
+	assert.Equal(t, "1", chapter.Number)
+	assert.Equal(t, "ch1.md", chapter.Path)
+	assert.Equal(t, "ch1.html", chapter.HtmlPath)
+	assert.Contains(t, chapter.Html, `<h2 id="overview">`)
+	assert.Equal(t, []HeadingInfo{{Level: "2", Text: "Overview", ID: "overview"}}, chapter.Headings)
+
+	require.Len(t, chapter.SubItems, 1)
+	assert.Equal(t, "1.2", chapter.SubItems[0].Number)
+	assert.Equal(t, []int{1, 2}, chapter.SubItems[0].NumberParts)
+	assert.Equal(t, []string{"Chapter 1", "Details"}, chapter.SubItems[0].Breadcrumbs)
+
+	draft := export.Items[3]
+	assert.True(t, draft.Draft)
+	assert.Empty(t, draft.Path)
+	assert.Empty(t, draft.Html)
+}
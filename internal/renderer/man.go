@@ -0,0 +1,371 @@
+package renderer
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/geocine/geopub/internal/models"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// manHardBreak marks a hard line break in inline output until lines are filled
+const manHardBreak = "\x00"
+
+// roffEscaper escapes characters that roff would otherwise interpret
+var roffEscaper = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+// ManRenderer renders every chapter to a roff man page, one file per chapter.
+// Pages are named after the chapter path, so guide/setup.md becomes guide-setup.1.
+//
+// Settings are read from [output.man]:
+//
+//	[output.man]
+//	section = 7               # default: 1
+//	manual = "Geopub Manual"  # default: book title
+type ManRenderer struct {
+	html *HtmlRenderer
+}
+
+// NewManRenderer creates a new man page renderer
+func NewManRenderer() *ManRenderer {
+	return &ManRenderer{html: NewHtmlRenderer()}
+}
+
+// Name returns the renderer name
+func (r *ManRenderer) Name() string {
+	return "man"
+}
+
+// Render writes a man page for every chapter into ctx.DestDir
+func (r *ManRenderer) Render(ctx *RenderContext) error {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	section := "1"
+	if v, ok := ctx.Config.Get("output.man.section"); ok {
+		section = fmt.Sprint(v)
+	}
+	manual := ctx.Config.GetString("output.man.manual", ctx.Config.Book.Title)
+	date := time.Now().Format("2006-01-02")
+
+	var chapters []*models.Chapter
+	pages := map[string]string{}
+	for _, ch := range ctx.Book.Chapters() {
+		if ch.Path == nil {
+			continue
+		}
+		chapters = append(chapters, ch)
+		pages[chapterKey(*ch.Path)] = manPageName(*ch.Path)
+	}
+
+	for _, ch := range chapters {
+		name := manPageName(*ch.Path)
+		w := &manWriter{
+			section: section,
+			dir:     path.Dir(chapterKey(*ch.Path)),
+			pages:   pages,
+		}
+		page := w.page(r.html.markdown.Parser(), ch, name, date, manual, ctx.Config.Book.Title)
+
+		filename := name + "." + section
+		if err := ctx.output().WriteFile(filepath.Join(ctx.DestDir, filename), []byte(page)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// manPageName derives a man page name from a chapter path
+func manPageName(p string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(chapterKey(p), ".md"), "/", "-")
+}
+
+// manWriter converts a chapter's Markdown AST to roff using the man macros
+type manWriter struct {
+	b        strings.Builder
+	source   []byte
+	section  string
+	dir      string
+	pages    map[string]string
+	hasTable bool
+}
+
+// page renders a complete man page for a chapter
+func (w *manWriter) page(p parser.Parser, ch *models.Chapter, name, date, manual, source string) string {
+	w.source = []byte(ch.Content)
+	doc := p.Parse(text.NewReader(w.source))
+
+	hasName := false
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		if h, ok := n.(*ast.Heading); ok && strings.EqualFold(string(h.Text(w.source)), "name") {
+			hasName = true
+			break
+		}
+	}
+	if !hasName {
+		w.b.WriteString(".SH NAME\n")
+		w.b.WriteString(w.fill(roffEscaper.Replace(name) + ` \- ` + roffEscaper.Replace(ch.Name)))
+	}
+	w.blocks(doc)
+
+	var out strings.Builder
+	if w.hasTable {
+		// Tells man(1) to run the page through tbl
+		out.WriteString("'\\\" t\n")
+	}
+	fmt.Fprintf(&out, ".TH %s %s %s %s %s\n",
+		roffQuote(strings.ToUpper(roffEscaper.Replace(name))), roffQuote(w.section),
+		roffQuote(date), roffQuote(source), roffQuote(manual))
+	out.WriteString(w.b.String())
+	return out.String()
+}
+
+// blocks renders the block children of n
+func (w *manWriter) blocks(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		w.block(c)
+	}
+}
+
+// block renders a single block node
+func (w *manWriter) block(n ast.Node) {
+	switch v := n.(type) {
+	case *ast.Heading:
+		heading := w.inlines(v)
+		switch v.Level {
+		case 1:
+			fmt.Fprintf(&w.b, ".SH %s\n", roffQuote(strings.ToUpper(heading)))
+		case 2:
+			fmt.Fprintf(&w.b, ".SS %s\n", roffQuote(heading))
+		default:
+			w.b.WriteString(".PP\n")
+			w.b.WriteString(w.fill(`\fB` + heading + `\fP`))
+		}
+	case *ast.Paragraph, *ast.TextBlock:
+		w.b.WriteString(".PP\n")
+		w.b.WriteString(w.fill(w.inlines(v)))
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		w.b.WriteString(".PP\n.RS 4\n.nf\n")
+		w.code(v)
+		w.b.WriteString(".fi\n.RE\n")
+	case *ast.List:
+		w.list(v)
+	case *ast.Blockquote:
+		w.b.WriteString(".PP\n.RS 4\n")
+		w.blocks(v)
+		w.b.WriteString(".RE\n")
+	case *ast.ThematicBreak:
+		w.b.WriteString(".sp\n")
+	case *ast.HTMLBlock:
+		// Raw HTML has no roff equivalent
+	case *extast.Table:
+		w.table(v)
+	case *extast.DefinitionList:
+		for c := v.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c.(type) {
+			case *extast.DefinitionTerm:
+				w.b.WriteString(".TP\n")
+				w.b.WriteString(w.fill(w.inlines(c)))
+			case *extast.DefinitionDescription:
+				w.itemBody(c)
+			}
+		}
+	case *extast.FootnoteList:
+		for c := v.FirstChild(); c != nil; c = c.NextSibling() {
+			if fn, ok := c.(*extast.Footnote); ok {
+				fmt.Fprintf(&w.b, ".IP \"[%d]\" 4\n", fn.Index)
+				w.itemBody(fn)
+			}
+		}
+	default:
+		w.blocks(v)
+	}
+}
+
+// list renders a bullet or ordered list as indented paragraphs
+func (w *manWriter) list(l *ast.List) {
+	number := l.Start
+	for c := l.FirstChild(); c != nil; c = c.NextSibling() {
+		if l.IsOrdered() {
+			fmt.Fprintf(&w.b, ".IP \"%d.\" 4\n", number)
+			number++
+		} else {
+			w.b.WriteString(".IP \\(bu 2\n")
+		}
+		w.itemBody(c)
+	}
+}
+
+// itemBody renders the content of a list item, definition or footnote. The first
+// paragraph continues the tagged paragraph; later blocks stay at the item's indent.
+func (w *manWriter) itemBody(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c.(type) {
+		case *ast.Paragraph, *ast.TextBlock:
+			if c != n.FirstChild() {
+				w.b.WriteString(".IP\n")
+			}
+			w.b.WriteString(w.fill(w.inlines(c)))
+		default:
+			w.b.WriteString(".RS\n")
+			w.block(c)
+			w.b.WriteString(".RE\n")
+		}
+	}
+}
+
+// code writes the lines of a code block verbatim, for use between .nf and .fi
+func (w *manWriter) code(n ast.Node) {
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		line := strings.TrimRight(string(seg.Value(w.source)), "\n")
+		w.b.WriteString(roffLine(roffEscaper.Replace(line)))
+		w.b.WriteString("\n")
+	}
+}
+
+// table renders a GFM table with tbl(1); the header row is set in bold
+func (w *manWriter) table(t *extast.Table) {
+	w.hasTable = true
+	var header, format []string
+	for _, align := range t.Alignments {
+		col := "l"
+		switch align {
+		case extast.AlignRight:
+			col = "r"
+		case extast.AlignCenter:
+			col = "c"
+		}
+		header = append(header, col+"b")
+		format = append(format, col)
+	}
+
+	w.b.WriteString(".PP\n.TS\nallbox;\n")
+	w.b.WriteString(strings.Join(header, " ") + "\n")
+	w.b.WriteString(strings.Join(format, " ") + " .\n")
+	for row := t.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			content := strings.NewReplacer("\t", " ", "\n", " ", manHardBreak, " ").Replace(w.inlines(cell))
+			cells = append(cells, `T{`+"\n"+roffLine(strings.TrimSpace(content))+"\n"+`T}`)
+		}
+		w.b.WriteString(strings.Join(cells, "\t") + "\n")
+	}
+	w.b.WriteString(".TE\n")
+}
+
+// inlines renders the inline children of n to escaped roff text
+func (w *manWriter) inlines(n ast.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		w.inline(&b, c)
+	}
+	return b.String()
+}
+
+// inline renders a single inline node
+func (w *manWriter) inline(b *strings.Builder, n ast.Node) {
+	switch v := n.(type) {
+	case *ast.Text:
+		b.WriteString(roffEscaper.Replace(string(v.Segment.Value(w.source))))
+		if v.HardLineBreak() {
+			b.WriteString("\n" + manHardBreak + "\n")
+		} else if v.SoftLineBreak() {
+			b.WriteString("\n")
+		}
+	case *ast.String:
+		b.WriteString(roffEscaper.Replace(string(v.Value)))
+	case *ast.CodeSpan:
+		b.WriteString(`\fB`)
+		for c := v.FirstChild(); c != nil; c = c.NextSibling() {
+			if t, ok := c.(*ast.Text); ok {
+				b.WriteString(roffEscaper.Replace(string(t.Segment.Value(w.source))))
+			}
+		}
+		b.WriteString(`\fP`)
+	case *ast.Emphasis:
+		font := `\fI`
+		if v.Level >= 2 {
+			font = `\fB`
+		}
+		b.WriteString(font + w.inlines(v) + `\fP`)
+	case *ast.Link:
+		b.WriteString(w.inlines(v))
+		b.WriteString(w.linkTarget(string(v.Destination)))
+	case *ast.AutoLink:
+		b.WriteString(`\[la]` + roffEscaper.Replace(string(v.URL(w.source))) + `\[ra]`)
+	case *ast.Image:
+		b.WriteString(w.inlines(v))
+	case *ast.RawHTML:
+		// Raw HTML has no roff equivalent
+	case *extast.TaskCheckBox:
+		if v.IsChecked {
+			b.WriteString("[x] ")
+		} else {
+			b.WriteString("[ ] ")
+		}
+	case *extast.FootnoteLink:
+		fmt.Fprintf(b, "[%d]", v.Index)
+	case *extast.FootnoteBacklink:
+	default:
+		b.WriteString(w.inlines(v))
+	}
+}
+
+// linkTarget renders the suffix shown after a link's text. Links to other chapters refer
+// to their man page, e.g. "(guide\-setup(1))"; in-page fragments are dropped.
+func (w *manWriter) linkTarget(dest string) string {
+	if dest == "" || strings.HasPrefix(dest, "#") {
+		return ""
+	}
+	if !strings.Contains(dest, "://") && !strings.HasPrefix(dest, "mailto:") {
+		file := dest
+		if i := strings.Index(file, "#"); i >= 0 {
+			file = file[:i]
+		}
+		if name, ok := w.pages[path.Clean(path.Join(w.dir, file))]; ok {
+			return fmt.Sprintf(` (\fB%s\fP(%s))`, roffEscaper.Replace(name), w.section)
+		}
+	}
+	return ` \[la]` + roffEscaper.Replace(dest) + `\[ra]`
+}
+
+// fill lays out escaped inline text for roff fill mode: leading whitespace and blank lines
+// are dropped, control characters at line start are protected, and hard breaks become .br
+func (w *manWriter) fill(s string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimLeft(line, " \t")
+		switch line {
+		case "":
+			continue
+		case manHardBreak:
+			b.WriteString(".br\n")
+			continue
+		}
+		b.WriteString(roffLine(line))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// roffLine protects a text line that would otherwise be read as a roff request
+func roffLine(line string) string {
+	if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+		return `\&` + line
+	}
+	return line
+}
+
+// roffQuote quotes a macro argument
+func roffQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\(dq`) + `"`
+}
@@ -0,0 +1,54 @@
+package renderer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManRender(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Title = "Tool"
+	cfg.Output["man"] = map[string]interface{}{"section": int64(7), "manual": "Tool Manual"}
+
+	intro := models.NewChapter("Introduction", "# Introduction\n\nSee [setup](guide/setup.md).\n", "intro.md", nil)
+	setup := models.NewChapter("Setup", "# Setup\n\n## Options\n\nUse *one* or **two** with `--force`.\n.starts with a dot\n\n- first\n- second\n\n1. step\n\n```sh\n.not a request\necho \\n\n```\n\nVisit <https://example.com>.\n", "guide/setup.md", nil)
+	book := models.NewBookWithItems([]models.BookItem{intro, setup, models.NewDraftChapter("Later", nil)})
+
+	out := t.TempDir()
+	require.NoError(t, NewManRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}))
+
+	introPage := testutil.ReadFile(t, out, "intro.7")
+	assert.Regexp(t, `^\.TH "INTRO" "7" "[0-9-]+" "Tool" "Tool Manual"\n\.SH NAME\nintro \\- Introduction\n\.SH "INTRODUCTION"\n`, introPage)
+	assert.Contains(t, introPage, `See setup (\fBguide\-setup\fP(7)).`)
+
+	page := testutil.ReadFile(t, out, "guide-setup.7")
+	assert.Contains(t, page, ".SS \"Options\"\n")
+	assert.Contains(t, page, `Use \fIone\fP or \fBtwo\fP with \fB\-\-force\fP.`+"\n"+`\&.starts with a dot`+"\n")
+	assert.Contains(t, page, ".IP \\(bu 2\nfirst\n.IP \\(bu 2\nsecond\n")
+	assert.Contains(t, page, ".IP \"1.\" 4\nstep\n")
+	assert.Contains(t, page, ".nf\n\\&.not a request\necho \\en\n.fi\n")
+	assert.Contains(t, page, `Visit \[la]https://example.com\[ra].`)
+	assert.NotContains(t, page, "'\\\" t")
+
+	assert.NoFileExists(t, filepath.Join(out, "Later.7"))
+}
+
+func TestManRenderTable(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	book := models.NewBookWithItems([]models.BookItem{
+		models.NewChapter("Flags", "| Flag | Meaning |\n|---|--:|\n| `-v` | verbose |\n", "flags.md", nil),
+	})
+
+	out := t.TempDir()
+	require.NoError(t, NewManRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}))
+
+	page := testutil.ReadFile(t, out, "flags.1")
+	assert.Regexp(t, `^'\\" t\n\.TH "FLAGS" "1" `, page)
+	assert.Contains(t, page, ".TS\nallbox;\nlb rb\nl r .\nT{\nFlag\nT}\tT{\nMeaning\nT}\nT{\n\\fB\\-v\\fP\nT}\tT{\nverbose\nT}\n.TE\n")
+}
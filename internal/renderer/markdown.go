@@ -0,0 +1,283 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	htmlutil "html"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/geocine/geopub/internal/models"
+	"github.com/yuin/goldmark"
+)
+
+var (
+	mdFenceRegex   = regexp.MustCompile("^\\s{0,3}(```+|~~~+)")
+	mdHeadingRegex = regexp.MustCompile(`^( {0,3})(#{1,6})(\s|$)`)
+	mdInlineLink   = regexp.MustCompile(`\]\(([^)\s]+)((?:\s+"[^"]*")?)\)`)
+	mdRefLink      = regexp.MustCompile(`^(\s{0,3}\[[^\]]+\]:\s*)(\S+)(.*)$`)
+	mdSchemeRegex  = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	mdTagRegex     = regexp.MustCompile(`<[^>]+>`)
+	// A setext heading underline, and lines that start a block a setext heading can't be
+	mdSetextRegex     = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	mdBlockStartRegex = regexp.MustCompile(`^ {0,3}([-*+>]|\d+[.)])(\s|$)|^ {0,3}([*_])( *[*_]){2,} *$|^ {0,3}(\||<)`)
+)
+
+// MarkdownRenderer concatenates every chapter into a single Markdown document, for feeding
+// the whole book into other tools.
+//
+// Settings are read from [output.markdown]:
+//
+//	[output.markdown]
+//	filename = "book.md"  # e.g. "book.txt" for a plain-text export
+type MarkdownRenderer struct{}
+
+// NewMarkdownRenderer creates a new single-file Markdown renderer
+func NewMarkdownRenderer() *MarkdownRenderer {
+	return &MarkdownRenderer{}
+}
+
+// Name returns the renderer name
+func (r *MarkdownRenderer) Name() string {
+	return "markdown"
+}
+
+// Render writes the combined document into ctx.DestDir, along with the files below the
+// source directory it links to, such as images, at the same paths
+func (r *MarkdownRenderer) Render(ctx *RenderContext) error {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	links := &markdownLinks{anchors: map[string]string{}, assets: map[string]bool{}}
+	if ctx.SourceDir != "" {
+		// Links leaving the source directory point back at it from the output
+		if rel, err := filepath.Rel(ctx.DestDir, ctx.SourceDir); err == nil {
+			links.outside = filepath.ToSlash(rel)
+		}
+	}
+	filename := ctx.Config.GetString("output.markdown.filename", "book.md")
+	outPath := filepath.Join(ctx.DestDir, filename)
+	if err := ctx.output().WriteFile(outPath, []byte(r.combine(ctx.Book, links))); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return r.copyAssets(ctx, links.assets)
+}
+
+// copyAssets copies the files the document links to from the source directory into the
+// output. Links to files that don't exist are left alone.
+func (r *MarkdownRenderer) copyAssets(ctx *RenderContext, assets map[string]bool) error {
+	if ctx.SourceDir == "" {
+		return nil
+	}
+	rels := make([]string, 0, len(assets))
+	for rel := range assets {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		src := filepath.Join(ctx.SourceDir, filepath.FromSlash(rel))
+		if info, err := os.Stat(src); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		dst := filepath.Join(ctx.DestDir, filepath.FromSlash(rel))
+		if err := ctx.output().MkdirAll(filepath.Dir(dst)); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", rel, err)
+		}
+		if err := writeCached(ctx, dst, data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// markdownLinks holds what rewriting the links of the combined document needs and finds
+type markdownLinks struct {
+	anchors map[string]string // Chapter path -> in-document anchor
+	outside string            // Path from the output directory to the source directory
+	assets  map[string]bool   // Files below the source directory the document links to
+}
+
+// combine joins chapter contents in reading order. Each chapter is preceded by an anchor
+// so intra-book .md links can be rewritten to point inside the document, and its headings
+// are demoted by the depth of its section number and get anchors scoped to the chapter.
+func (r *MarkdownRenderer) combine(book *models.Book, links *markdownLinks) string {
+	var chapters []*models.Chapter
+	for _, ch := range book.Chapters() {
+		if ch.Path == nil {
+			continue
+		}
+		chapters = append(chapters, ch)
+		links.anchors[chapterKey(*ch.Path)] = chapterAnchor(*ch.Path)
+	}
+
+	var b strings.Builder
+	for i, ch := range chapters {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "<a id=\"%s\"></a>\n\n", chapterAnchor(*ch.Path))
+
+		demote := 0
+		if ch.Number != nil && len(ch.Number.Parts) > 1 {
+			demote = len(ch.Number.Parts) - 1
+		}
+		dir := path.Dir(chapterKey(*ch.Path))
+		b.WriteString(rewriteChapterMarkdown(ch.Content, dir, chapterAnchor(*ch.Path), demote, links))
+		if !strings.HasSuffix(ch.Content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// chapterKey normalizes a chapter path for lookups
+func chapterKey(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// chapterAnchor derives the in-document anchor for a chapter from its path
+func chapterAnchor(p string) string {
+	p = strings.TrimSuffix(chapterKey(p), ".md")
+	return slugify(strings.ReplaceAll(p, "/", " "))
+}
+
+// rewriteChapterMarkdown demotes ATX and setext headings, puts an anchor scoped to the
+// chapter before each of them and rewrites links outside of fenced code blocks
+func rewriteChapterMarkdown(content, dir, anchor string, demote int, links *markdownLinks) string {
+	var out []string
+	fence := ""
+	ids := newHeadingIDs()
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := mdFenceRegex.FindStringSubmatch(line); m != nil {
+			marker := m[1][:3]
+			if fence == "" {
+				fence = marker
+			} else if fence == marker {
+				fence = ""
+			}
+			out = append(out, line)
+			continue
+		}
+		if fence != "" {
+			out = append(out, line)
+			continue
+		}
+
+		// Same IDs as the html backend gives the heading, so chapter.md#id links still match
+		if m := mdHeadingRegex.FindStringSubmatch(line); m != nil {
+			out = append(out, fmt.Sprintf("<a id=\"%s-%s\"></a>", anchor, ids.next(markdownHeadingText(line))), "")
+			if demote > 0 {
+				line = m[1] + strings.Repeat("#", demotedLevel(len(m[2]), demote)) + line[len(m[1])+len(m[2]):]
+			}
+		} else if level := setextLevel(lines, i); level > 0 {
+			text := strings.TrimSpace(line)
+			out = append(out, fmt.Sprintf("<a id=\"%s-%s\"></a>", anchor, ids.next(markdownHeadingText("# "+text))), "")
+			if demote > 0 {
+				// Setext headings only have two levels, so demoted ones become ATX headings
+				line = strings.Repeat("#", demotedLevel(level, demote)) + " " + text
+				i++
+			}
+		}
+
+		line = mdInlineLink.ReplaceAllStringFunc(line, func(match string) string {
+			sub := mdInlineLink.FindStringSubmatch(match)
+			return "](" + links.rewrite(sub[1], dir, anchor) + sub[2] + ")"
+		})
+		if sub := mdRefLink.FindStringSubmatch(line); sub != nil {
+			line = sub[1] + links.rewrite(sub[2], dir, anchor) + sub[3]
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// demotedLevel returns the level of a heading demoted by demote, at most 6
+func demotedLevel(level, demote int) int {
+	if level+demote > 6 {
+		return 6
+	}
+	return level + demote
+}
+
+// setextLevel returns the level of the setext heading whose text is lines[i], or 0 if
+// lines[i] doesn't start one. Only single-line headings after a blank line count, so
+// list items, block quotes and paragraphs followed by a rule are left alone.
+func setextLevel(lines []string, i int) int {
+	if i+1 >= len(lines) || (i > 0 && strings.TrimSpace(lines[i-1]) != "") {
+		return 0
+	}
+	line := lines[i]
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") ||
+		mdBlockStartRegex.MatchString(line) || mdSetextRegex.MatchString(line) {
+		return 0
+	}
+	m := mdSetextRegex.FindStringSubmatch(lines[i+1])
+	if m == nil {
+		return 0
+	}
+	if m[1][0] == '=' {
+		return 1
+	}
+	return 2
+}
+
+// markdownHeadingText returns the plain text of an ATX heading line as it renders
+func markdownHeadingText(line string) string {
+	var buf bytes.Buffer
+	if err := goldmark.Convert([]byte(strings.TrimSpace(line)), &buf); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(htmlutil.UnescapeString(mdTagRegex.ReplaceAllString(buf.String(), "")))
+}
+
+// rewrite maps a relative link to another chapter onto its in-document anchor, and
+// fragments onto the heading anchors scoped to their chapter. Other relative links, such
+// as images, are rebased from the chapter's directory onto the source root; the files
+// they point to are copied to the same place next to the document. Links leaving the
+// source directory are rebased onto the output directory instead. Absolute links are
+// returned unchanged.
+func (l *markdownLinks) rewrite(target, dir, anchor string) string {
+	if mdSchemeRegex.MatchString(target) || strings.HasPrefix(target, "/") {
+		return target
+	}
+	file, frag := target, ""
+	if i := strings.Index(target, "#"); i >= 0 {
+		file, frag = target[:i], target[i+1:]
+	}
+	if file == "" {
+		return "#" + anchor + "-" + frag
+	}
+	rebased := path.Join(dir, file)
+	if other, ok := l.anchors[rebased]; ok && strings.HasSuffix(file, ".md") {
+		if frag != "" {
+			return "#" + other + "-" + frag
+		}
+		return "#" + other
+	}
+	if rebased == ".." || strings.HasPrefix(rebased, "../") {
+		if l.outside != "" {
+			rebased = path.Join(l.outside, rebased)
+		}
+	} else {
+		asset := rebased
+		if i := strings.Index(asset, "?"); i >= 0 {
+			asset = asset[:i]
+		}
+		l.assets[asset] = true
+	}
+	if frag != "" {
+		return rebased + "#" + frag
+	}
+	return rebased
+}
@@ -0,0 +1,122 @@
+package renderer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownRender(t *testing.T) {
+	intro := models.NewChapter("Introduction", "# Introduction\n\nRead [setup](guide/setup.md) first.", "intro.md", nil)
+
+	guide := models.NewChapter("Guide", "# Guide\n\nSee [install](setup.md#install) and ![diagram](img/flow.png).\n\n## Install\n", "guide/index.md", nil)
+	guide.Number = &models.SectionNumber{Parts: []int{1}}
+
+	setup := models.NewChapter("Setup", "# Setup\n\n## Install\n\n```sh\n# not a heading\n[x](../intro.md)\n```\n\nBack to [intro](../intro.md), [top](#setup) or [docs](https://example.com/README.md).\n\n[ref]: ../intro.md\n", "guide/setup.md", nil)
+	setup.Number = &models.SectionNumber{Parts: []int{1, 1}}
+	guide.SubItems = append(guide.SubItems, setup)
+
+	book := models.NewBookWithItems([]models.BookItem{intro, &models.Separator{}, guide, models.NewDraftChapter("Later", nil)})
+
+	cfg := config.NewDefaultConfig()
+	out := t.TempDir()
+	ctx := &RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}
+	require.NoError(t, NewMarkdownRenderer().Render(ctx))
+
+	got := testutil.ReadFile(t, out, "book.md")
+	want := `<a id="intro"></a>
+
+<a id="intro-introduction"></a>
+
+# Introduction
+
+Read [setup](#guide-setup) first.
+
+<a id="guide-index"></a>
+
+<a id="guide-index-guide"></a>
+
+# Guide
+
+See [install](#guide-setup-install) and ![diagram](guide/img/flow.png).
+
+<a id="guide-index-install"></a>
+
+## Install
+
+<a id="guide-setup"></a>
+
+<a id="guide-setup-setup"></a>
+
+## Setup
+
+<a id="guide-setup-install"></a>
+
+### Install
+
+` + "```sh\n# not a heading\n[x](../intro.md)\n```" + `
+
+Back to [intro](#intro), [top](#guide-setup-setup) or [docs](https://example.com/README.md).
+
+[ref]: #intro
+`
+	assert.Equal(t, want, got)
+}
+
+func TestMarkdownRenderFilename(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Output["markdown"] = map[string]interface{}{"filename": "book.txt"}
+	book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "# One", "one.md", nil)})
+
+	out := t.TempDir()
+	require.NoError(t, NewMarkdownRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}))
+	assert.FileExists(t, filepath.Join(out, "book.txt"))
+}
+
+func TestMarkdownRenderSetextHeadings(t *testing.T) {
+	parent := models.NewChapter("Parent", "Parent\n======\n", "parent.md", nil)
+	parent.Number = &models.SectionNumber{Parts: []int{1}}
+	child := models.NewChapter("Child", "Child\n=====\n\nUsage\n-----\n\n- item\n---\n\nSee [usage](#usage).\n", "child.md", nil)
+	child.Number = &models.SectionNumber{Parts: []int{1, 1}}
+	parent.SubItems = append(parent.SubItems, child)
+
+	out := t.TempDir()
+	require.NoError(t, NewMarkdownRenderer().Render(&RenderContext{
+		Root: ".", DestDir: out, Book: models.NewBookWithItems([]models.BookItem{parent}), Config: config.NewDefaultConfig(),
+	}))
+
+	got := testutil.ReadFile(t, out, "book.md")
+	// Top-level setext headings are kept, nested ones become demoted ATX headings
+	assert.Contains(t, got, "<a id=\"parent-parent\"></a>\n\nParent\n======\n")
+	assert.Contains(t, got, "<a id=\"child-child\"></a>\n\n## Child\n")
+	assert.Contains(t, got, "<a id=\"child-usage\"></a>\n\n### Usage\n")
+	// A rule after a list item is not a heading
+	assert.Contains(t, got, "- item\n---\n")
+	assert.Contains(t, got, "[usage](#child-usage)")
+}
+
+func TestMarkdownRenderCopiesLinkedFiles(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	src := filepath.Join(root, "src")
+	testutil.WriteFile(t, src, filepath.Join("guide", "img", "flow.png"), "png")
+	testutil.WriteFile(t, root, "LICENSE", "license")
+	guide := models.NewChapter("Guide", "![diagram](img/flow.png?v=2) [missing](img/none.png) [license](../../LICENSE)\n", "guide/index.md", nil)
+
+	out := filepath.Join(root, "book", "markdown")
+	require.NoError(t, NewMarkdownRenderer().Render(&RenderContext{
+		Root: root, DestDir: out, SourceDir: src, Book: models.NewBookWithItems([]models.BookItem{guide}), Config: config.NewDefaultConfig(),
+	}))
+
+	got := testutil.ReadFile(t, out, "book.md")
+	assert.Contains(t, got, "![diagram](guide/img/flow.png?v=2)")
+	assert.Equal(t, "png", testutil.ReadFile(t, out, filepath.Join("guide", "img", "flow.png")))
+	assert.NoFileExists(t, filepath.Join(out, "guide", "img", "none.png"))
+	// Files outside the source directory are linked from the output instead
+	assert.Contains(t, got, "[license](../../LICENSE)")
+	assert.Equal(t, "license", testutil.ReadFile(t, out, filepath.Join("..", "..", "LICENSE")))
+}
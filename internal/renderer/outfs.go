@@ -0,0 +1,183 @@
+package renderer
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputFS receives the files written by the built-in backends
+type OutputFS interface {
+	MkdirAll(dir string) error
+	WriteFile(name string, data []byte) error
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// DiskFS writes output files to the real filesystem
+var DiskFS OutputFS = diskFS{}
+
+type diskFS struct{}
+
+func (diskFS) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
+
+func (diskFS) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
+
+func (diskFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// output returns where the backends write their files
+func (ctx *RenderContext) output() OutputFS {
+	if ctx.Output == nil {
+		return DiskFS
+	}
+	return ctx.Output
+}
+
+// MemFS is an OutputFS that keeps files in memory. It is also an fs.FS, so the
+// output can be served directly. Paths are cleaned and use forward slashes.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memEntry
+}
+
+// memEntry is a file held by a MemFS. Its data is never modified after it is stored.
+type memEntry struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFS returns an empty in-memory filesystem
+func NewMemFS() *MemFS {
+	return &MemFS{files: map[string]*memEntry{}}
+}
+
+// Clone returns a copy of the filesystem that can be written without affecting m
+func (m *MemFS) Clone() *MemFS {
+	c := NewMemFS()
+	if m == nil {
+		return c
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for name, e := range m.files {
+		c.files[name] = e
+	}
+	return c
+}
+
+// memPath normalizes an OutputFS or fs.FS path to a MemFS key
+func memPath(name string) string {
+	return path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+}
+
+// MkdirAll is a no-op, directories exist implicitly
+func (m *MemFS) MkdirAll(dir string) error {
+	return nil
+}
+
+// WriteFile stores a copy of data as the file name
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	e := &memEntry{data: append([]byte(nil), data...), modTime: time.Now()}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[memPath(name)] = e
+	return nil
+}
+
+// Stat describes the file or implicit directory name
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	key := memPath(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if e, ok := m.files[key]; ok {
+		return &memInfo{name: path.Base(key), size: int64(len(e.data)), modTime: e.modTime}, nil
+	}
+	if m.isDir(key) {
+		return &memInfo{name: path.Base(key), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// isDir reports whether any file lives below key; m.mu must be held
+func (m *MemFS) isDir(key string) bool {
+	if key == "." {
+		return true
+	}
+	for name := range m.files {
+		if strings.HasPrefix(name, key+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFile returns the contents of the file name
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), e.data...), nil
+}
+
+// Open implements fs.FS. Only files can be opened.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.files[name]
+	if !ok {
+		if m.isDir(name) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{
+		Reader: bytes.NewReader(e.data),
+		info:   &memInfo{name: path.Base(name), size: int64(len(e.data)), modTime: e.modTime},
+	}, nil
+}
+
+// memFile is an open MemFS file
+type memFile struct {
+	*bytes.Reader
+	info *memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+// memInfo describes a MemFS file or directory
+type memInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.dir }
+func (i *memInfo) Sys() any           { return nil }
+
+func (i *memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
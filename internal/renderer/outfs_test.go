@@ -0,0 +1,128 @@
+package renderer
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	require.NoError(t, m.WriteFile(filepath.Join("guide", "one.html"), []byte("one")))
+	require.NoError(t, m.WriteFile("./index.html", []byte("index")))
+
+	data, err := fs.ReadFile(m, "guide/one.html")
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(data))
+
+	f, err := m.Open("index.html")
+	require.NoError(t, err)
+	_, err = f.(io.Seeker).Seek(1, io.SeekStart)
+	require.NoError(t, err)
+	rest, _ := io.ReadAll(f)
+	assert.Equal(t, "ndex", string(rest))
+
+	info, err := fs.Stat(m, "guide")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	_, err = m.Stat("missing.html")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// Writes to a clone don't show up in the original
+	c := m.Clone()
+	require.NoError(t, c.WriteFile("index.html", []byte("changed")))
+	data, _ = m.ReadFile("index.html")
+	assert.Equal(t, "index", string(data))
+}
+
+func TestRenderIntoMemory(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	testutil.WriteFile(t, root, filepath.Join("src", "img.txt"), "asset")
+	one := models.NewChapter("One", "# One", "one.md", nil)
+
+	files := NewMemFS()
+	var cache *BuildCache
+	render := func() []string {
+		out := files.Clone()
+		c := cache.Clone()
+		require.NoError(t, NewHtmlRenderer().Render(&RenderContext{
+			Root:      root,
+			DestDir:   ".",
+			Book:      models.NewBookWithItems([]models.BookItem{one}),
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Cache:     c,
+			Output:    out,
+		}))
+		require.NoError(t, c.Save())
+		files, cache = out, c
+		return c.Written()
+	}
+
+	written := render()
+	assert.Contains(t, written, "one.html")
+	page, err := files.ReadFile("one.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "<h1")
+	asset, err := files.ReadFile("img.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "asset", string(asset))
+	assert.NoDirExists(t, filepath.Join(root, "book"))
+
+	// The cache carries over to the next build in memory
+	one.Content = "# One\n\nEdited."
+	assert.Equal(t, []string{"index.html", "one.html", "print.html", "searchindex.js"}, render())
+}
+
+func TestNotFoundPageUsesBasePath(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	files := NewMemFS()
+	require.NoError(t, NewHtmlRenderer().Render(&RenderContext{
+		Root:      root,
+		DestDir:   ".",
+		Book:      models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "# One", "one.md", nil)}),
+		Config:    config.NewDefaultConfig(),
+		SourceDir: filepath.Join(root, "src"),
+		AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+		BasePath:  "/docs/",
+		Output:    files,
+	}))
+	page, err := files.ReadFile("404.html")
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<base href="/docs/">`)
+}
+
+func TestThemeIsReadFromBookRoot(t *testing.T) {
+	render := func(root string) string {
+		files := NewMemFS()
+		require.NoError(t, NewHtmlRenderer().Render(&RenderContext{
+			Root:      root,
+			DestDir:   ".",
+			Book:      models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "# One", "one.md", nil)}),
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Output:    files,
+		}))
+		page, err := files.ReadFile("one.html")
+		require.NoError(t, err)
+		return string(page)
+	}
+
+	themed := testutil.TempBook(t, "themed")
+	testutil.WriteFile(t, themed, filepath.Join("theme", "header.hbs"), `<div id="themed-header"></div>`)
+	plain := testutil.TempBook(t, "plain")
+
+	// Partials of one book's theme don't leak into another book
+	assert.Contains(t, render(themed), "themed-header")
+	assert.NotContains(t, render(plain), "themed-header")
+}
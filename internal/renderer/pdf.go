@@ -0,0 +1,1017 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/pdf"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// pdfHeadingScale is the size of each heading level relative to body text
+var pdfHeadingScale = map[int]float64{1: 1.9, 2: 1.5, 3: 1.25}
+
+// PdfRenderer lays out the print version of the book (every chapter in reading order,
+// each starting on a new page) as a PDF with a title page, a table of contents and a
+// bookmark for every chapter and heading. It needs no browser, so it runs headless in CI.
+// Local JPEG, PNG and GIF images are embedded and the text of raw HTML blocks is kept.
+// Text is set in the standard PDF fonts, which only cover Western European scripts;
+// other characters are reported and appear as '?'.
+//
+// Settings are read from [output.pdf]:
+//
+//	[output.pdf]
+//	filename = "my-book.pdf"  # default: slugified book title
+//	page-size = "letter"      # "a4" (default) or "letter"
+//	font-size = 10            # body text size in points, default 11
+type PdfRenderer struct {
+	html *HtmlRenderer
+}
+
+// NewPdfRenderer creates a new PDF renderer
+func NewPdfRenderer() *PdfRenderer {
+	return &PdfRenderer{html: NewHtmlRenderer()}
+}
+
+// Name returns the renderer name
+func (r *PdfRenderer) Name() string {
+	return "pdf"
+}
+
+// Render writes the PDF into ctx.DestDir
+func (r *PdfRenderer) Render(ctx *RenderContext) error {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	pageSize := ctx.Config.GetString("output.pdf.page-size", "a4")
+	width, height, ok := pdfPageSize(pageSize)
+	if !ok {
+		return fmt.Errorf("unknown output.pdf.page-size %q (expected \"a4\" or \"letter\")", pageSize)
+	}
+	fontSize := 11.0
+	if v, ok := ctx.Config.Get("output.pdf.font-size"); ok {
+		switch n := v.(type) {
+		case int64:
+			fontSize = float64(n)
+		case float64:
+			fontSize = n
+		}
+	}
+
+	doc := pdf.New(width, height)
+	doc.Title = ctx.Config.Book.Title
+	doc.Author = strings.Join(ctx.Config.Book.Authors, ", ")
+
+	l := &pdfLayout{
+		doc:       doc,
+		parser:    r.html.markdown.Parser(),
+		size:      fontSize,
+		margin:    56,
+		sourceDir: ctx.SourceDir,
+		dests:     map[string]pdf.Dest{},
+		images:    map[string]*pdf.Image{},
+	}
+	l.checkText("book.toml", ctx.Config.Book.Title+strings.Join(ctx.Config.Book.Authors, "")+ctx.Config.Book.Description)
+	l.items(ctx.Book.Items, 1)
+	l.frontMatter(ctx.Config.Book.Title, ctx.Config.Book.Authors, ctx.Config.Book.Description)
+	l.resolveLinks()
+	for _, w := range l.warnings {
+		log.Printf("Warning: pdf: %s", w)
+	}
+
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		return fmt.Errorf("failed to encode PDF: %w", err)
+	}
+	filename := r.filename(ctx)
+	if err := ctx.output().WriteFile(filepath.Join(ctx.DestDir, filename), buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
+
+// filename returns the PDF file name from config or the book title
+func (r *PdfRenderer) filename(ctx *RenderContext) string {
+	if name := ctx.Config.GetString("output.pdf.filename", ""); name != "" {
+		return name
+	}
+	if slug := slugify(ctx.Config.Book.Title); slug != "" {
+		return slug + ".pdf"
+	}
+	return "book.pdf"
+}
+
+// pdfPageSize returns the dimensions of a named page size
+func pdfPageSize(name string) (float64, float64, bool) {
+	switch strings.ToLower(name) {
+	case "a4":
+		return pdf.A4Width, pdf.A4Height, true
+	case "letter":
+		return pdf.LetterWidth, pdf.LetterHeight, true
+	}
+	return 0, 0, false
+}
+
+// pdfStyle is the formatting of a run of inline text
+type pdfStyle struct {
+	bold, italic, mono bool
+	size               float64
+	link               string
+}
+
+// font returns the standard font for the style
+func (s pdfStyle) font() pdf.Font {
+	switch {
+	case s.mono:
+		return pdf.Mono
+	case s.bold && s.italic:
+		return pdf.BoldItalic
+	case s.bold:
+		return pdf.Bold
+	case s.italic:
+		return pdf.Italic
+	}
+	return pdf.Regular
+}
+
+// pdfWord is an unbreakable piece of text, a space, or a hard line break
+type pdfWord struct {
+	text  string
+	style pdfStyle
+	space bool
+	br    bool
+}
+
+func (w pdfWord) width() float64 {
+	return pdf.TextWidth(w.style.font(), w.style.size, w.text)
+}
+
+// pdfTocEntry is a line in the generated table of contents
+type pdfTocEntry struct {
+	title string
+	level int
+	part  bool
+	dest  pdf.Dest
+}
+
+// pdfLink is an internal link waiting for its target to be laid out
+type pdfLink struct {
+	page       *pdf.Page
+	x, y, w, h float64
+	target     string
+}
+
+// pdfLayout flows chapter content onto pages top to bottom
+type pdfLayout struct {
+	doc    *pdf.Document
+	parser parser.Parser
+	size   float64
+	margin float64
+
+	page   *pdf.Page
+	y      float64   // top of the next line
+	indent float64   // left indent from the margin
+	bars   []float64 // x positions of blockquote bars
+	marker string    // list marker to draw on the next line
+
+	sourceDir string
+	images    map[string]*pdf.Image // embedded images by file, nil if they can't be embedded
+	warnings  []string
+
+	source  []byte
+	key     string // chapter path, for links and heading destinations
+	dir     string
+	name    string
+	level   int // bookmark level of the current chapter
+	ids     *headingIDs
+	parts   []string // part titles waiting for the next chapter
+	toc     []pdfTocEntry
+	dests   map[string]pdf.Dest
+	pending []pdfLink
+}
+
+// top returns the y position of the first line on a page
+func (l *pdfLayout) top() float64 {
+	_, height := l.doc.Size()
+	return height - l.margin
+}
+
+// contentWidth returns the width between the page margins
+func (l *pdfLayout) contentWidth() float64 {
+	width, _ := l.doc.Size()
+	return width - 2*l.margin
+}
+
+// ensure starts a new page unless h points fit below the current position
+func (l *pdfLayout) ensure(h float64) {
+	if l.y-h < l.margin && l.y < l.top() {
+		l.page = l.doc.AddPage()
+		l.y = l.top()
+	}
+}
+
+// items lays out chapters in reading order; part titles are attached to the next chapter
+func (l *pdfLayout) items(items []models.BookItem, depth int) {
+	for _, item := range items {
+		switch v := item.(type) {
+		case *models.PartTitle:
+			l.parts = append(l.parts, v.Title)
+		case *models.Chapter:
+			if v.Path != nil {
+				l.chapter(v, depth)
+			}
+			l.items(v.SubItems, depth+1)
+		}
+	}
+}
+
+// chapter lays out a chapter starting on a new page
+func (l *pdfLayout) chapter(ch *models.Chapter, depth int) {
+	l.page = l.doc.AddPage()
+	l.y = l.top()
+	l.indent, l.bars, l.marker = 0, nil, ""
+
+	start := pdf.Dest{Page: l.page, Y: l.y + l.margin/2}
+	for _, part := range l.parts {
+		l.toc = append(l.toc, pdfTocEntry{title: part, part: true, dest: start})
+		l.doc.AddBookmark(part, 0, start)
+	}
+	l.parts = nil
+
+	title := ch.Name
+	if ch.Number != nil && len(ch.Number.Parts) > 0 {
+		title = ch.Number.String() + ". " + title
+	}
+	l.toc = append(l.toc, pdfTocEntry{title: title, level: depth - 1, dest: start})
+	l.doc.AddBookmark(title, depth, start)
+
+	l.key = chapterKey(*ch.Path)
+	l.dir = path.Dir(l.key)
+	l.checkText(l.key, ch.Name+ch.Content)
+	l.name = ch.Name
+	l.level = depth
+	l.ids = newHeadingIDs()
+	l.dests[l.key] = start
+
+	l.source = []byte(ch.Content)
+	l.blocks(l.parser.Parse(text.NewReader(l.source)))
+}
+
+// blocks lays out the block children of n
+func (l *pdfLayout) blocks(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		l.block(c)
+	}
+}
+
+// block lays out a single block node
+func (l *pdfLayout) block(n ast.Node) {
+	body := pdfStyle{size: l.size}
+	switch v := n.(type) {
+	case *ast.Heading:
+		l.heading(v)
+	case *ast.Paragraph:
+		l.imageParagraph(v, body)
+		l.y -= l.size * 0.6
+	case *ast.TextBlock:
+		l.paragraph(l.runs(v, body), l.size)
+		l.y -= l.size * 0.15
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		l.code(v)
+	case *ast.List:
+		number := v.Start
+		for item := v.FirstChild(); item != nil; item = item.NextSibling() {
+			l.marker = "•"
+			if v.IsOrdered() {
+				l.marker = strconv.Itoa(number) + "."
+				number++
+			}
+			l.indent += 18
+			l.blocks(item)
+			l.indent -= 18
+		}
+		l.marker = ""
+		l.y -= l.size * 0.4
+	case *ast.Blockquote:
+		l.bars = append(l.bars, l.margin+l.indent+4)
+		l.indent += 16
+		l.blocks(v)
+		l.indent -= 16
+		l.bars = l.bars[:len(l.bars)-1]
+	case *ast.ThematicBreak:
+		l.ensure(l.size)
+		l.page.SetStrokeColor(0.7, 0.7, 0.7)
+		l.page.Line(l.margin+l.indent, l.y-l.size/2, l.margin+l.contentWidth(), l.y-l.size/2, 0.5)
+		l.y -= l.size * 1.5
+	case *ast.HTMLBlock:
+		l.htmlBlock(v)
+	case *extast.Table:
+		l.table(v)
+	case *extast.DefinitionList:
+		for c := v.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c.(type) {
+			case *extast.DefinitionTerm:
+				l.paragraph(l.runs(c, pdfStyle{size: l.size, bold: true}), l.size)
+			case *extast.DefinitionDescription:
+				l.indent += 18
+				l.blocks(c)
+				l.indent -= 18
+			}
+		}
+	case *extast.FootnoteList:
+		l.ensure(l.size)
+		l.page.SetStrokeColor(0.7, 0.7, 0.7)
+		l.page.Line(l.margin, l.y-l.size/2, l.margin+l.contentWidth()/3, l.y-l.size/2, 0.5)
+		l.y -= l.size
+		for c := v.FirstChild(); c != nil; c = c.NextSibling() {
+			if fn, ok := c.(*extast.Footnote); ok {
+				l.marker = fmt.Sprintf("[%d]", fn.Index)
+				l.indent += 18
+				l.blocks(fn)
+				l.indent -= 18
+			}
+		}
+		l.marker = ""
+	default:
+		l.blocks(v)
+	}
+}
+
+// heading lays out a heading, keeping it on the same page as the text that follows,
+// and records a bookmark and link destination for it
+func (l *pdfLayout) heading(h *ast.Heading) {
+	scale, ok := pdfHeadingScale[h.Level]
+	if !ok {
+		scale = 1.1
+	}
+	size := l.size * scale
+	if l.y < l.top() {
+		l.y -= size * 0.6
+	}
+	l.ensure(size*1.35 + l.size*2.8)
+
+	plain := l.plainText(h)
+	dest := pdf.Dest{Page: l.page, Y: l.y + size*0.6}
+	id := l.ids.next(plain)
+	l.dests[l.key+"#"+id] = dest
+	// The chapter's own bookmark already stands for its title heading
+	if h.Level != 1 || plain != l.name {
+		l.doc.AddBookmark(plain, l.level+h.Level, dest)
+	}
+
+	l.paragraph(l.runs(h, pdfStyle{size: size, bold: true}), size)
+	l.y -= size * 0.3
+}
+
+// paragraph wraps inline runs to the available width and lays out the lines
+func (l *pdfLayout) paragraph(words []pdfWord, size float64) {
+	x := l.margin + l.indent
+	for _, line := range wrapPdfWords(words, l.contentWidth()-l.indent) {
+		baseline := l.startLine(size * 1.35)
+		l.drawWords(line, x, baseline)
+		l.y -= size * 1.35
+	}
+}
+
+// startLine makes room for a line of height lh, draws blockquote bars and any pending
+// list marker beside it, and returns the baseline
+func (l *pdfLayout) startLine(lh float64) float64 {
+	l.ensure(lh)
+	baseline := l.y - lh*0.78
+	if len(l.bars) > 0 {
+		l.page.SetStrokeColor(0.8, 0.8, 0.8)
+		for _, x := range l.bars {
+			l.page.Line(x, l.y, x, l.y-lh, 2)
+		}
+	}
+	if l.marker != "" {
+		w := pdf.TextWidth(pdf.Regular, l.size, l.marker)
+		l.page.Text(l.margin+l.indent-6-w, baseline, pdf.Regular, l.size, l.marker)
+		l.marker = ""
+	}
+	return baseline
+}
+
+// code lays out a code block on a shaded background, hard-wrapping long lines
+func (l *pdfLayout) code(n ast.Node) {
+	size := l.size * 0.85
+	lh := size * 1.35
+	x := l.margin + l.indent
+	width := l.contentWidth() - l.indent
+	maxChars := int((width - 12) / pdf.TextWidth(pdf.Mono, size, " "))
+	if maxChars < 1 {
+		maxChars = 1
+	}
+
+	var lines []string
+	segments := n.Lines()
+	for i := 0; i < segments.Len(); i++ {
+		seg := segments.At(i)
+		line := strings.ReplaceAll(strings.TrimRight(string(seg.Value(l.source)), "\r\n"), "\t", "    ")
+		for utf8.RuneCountInString(line) > maxChars {
+			runes := []rune(line)
+			lines = append(lines, string(runes[:maxChars]))
+			line = string(runes[maxChars:])
+		}
+		lines = append(lines, line)
+	}
+
+	pad := size * 0.5
+	for i, line := range lines {
+		h := lh
+		if i == 0 || i == len(lines)-1 {
+			h += pad
+		}
+		l.ensure(h)
+		top := l.y
+		if i == 0 {
+			l.y -= pad
+		}
+		baseline := l.startLine(lh)
+		l.page.SetFillColor(0.95, 0.95, 0.95)
+		l.page.Rect(x, top-h, width, h, true)
+		l.page.SetFillColor(0, 0, 0)
+		l.page.Text(x+6, baseline, pdf.Mono, size, line)
+		l.y = top - h
+	}
+	l.y -= l.size * 0.6
+}
+
+// table lays out a GFM table with equal-width columns and bordered cells
+func (l *pdfLayout) table(t *extast.Table) {
+	cols := len(t.Alignments)
+	if cols == 0 {
+		return
+	}
+	x := l.margin + l.indent
+	colW := (l.contentWidth() - l.indent) / float64(cols)
+	pad := 4.0
+	lh := l.size * 1.35
+
+	for row := t.FirstChild(); row != nil; row = row.NextSibling() {
+		_, header := row.(*extast.TableHeader)
+		var cells [][][]pdfWord
+		rowLines := 1
+		for cell := row.FirstChild(); cell != nil && len(cells) < cols; cell = cell.NextSibling() {
+			lines := wrapPdfWords(l.runs(cell, pdfStyle{size: l.size, bold: header}), colW-2*pad)
+			cells = append(cells, lines)
+			if len(lines) > rowLines {
+				rowLines = len(lines)
+			}
+		}
+
+		h := float64(rowLines)*lh + 2*pad
+		l.ensure(h)
+		top := l.y
+		l.page.SetStrokeColor(0.6, 0.6, 0.6)
+		for i, lines := range cells {
+			cx := x + float64(i)*colW
+			l.page.Rect(cx, top-h, colW, h, false)
+			for j, line := range lines {
+				lx := cx + pad
+				switch t.Alignments[i] {
+				case extast.AlignRight:
+					lx = cx + colW - pad - lineWidth(line)
+				case extast.AlignCenter:
+					lx = cx + (colW-lineWidth(line))/2
+				}
+				l.drawWords(line, lx, top-pad-float64(j)*lh-lh*0.78)
+			}
+		}
+		l.y = top - h
+	}
+	l.y -= l.size * 0.6
+}
+
+// drawWords draws a line of words starting at x, merging words of the same style
+func (l *pdfLayout) drawWords(line []pdfWord, x, baseline float64) {
+	for i := 0; i < len(line); {
+		j := i + 1
+		for j < len(line) && line[j].style == line[i].style {
+			j++
+		}
+		var sb strings.Builder
+		for _, w := range line[i:j] {
+			sb.WriteString(w.text)
+		}
+		st := line[i].style
+		s := sb.String()
+		w := pdf.TextWidth(st.font(), st.size, s)
+
+		if st.link != "" {
+			l.page.SetFillColor(0.1, 0.3, 0.7)
+		}
+		l.page.Text(x, baseline, st.font(), st.size, s)
+		if st.link != "" {
+			l.page.SetFillColor(0, 0, 0)
+			ly, lh := baseline-st.size*0.25, st.size*1.2
+			if uri, target := l.linkTarget(st.link); uri != "" {
+				l.page.LinkToURI(x, ly, w, lh, uri)
+			} else if target != "" {
+				l.pending = append(l.pending, pdfLink{page: l.page, x: x, y: ly, w: w, h: lh, target: target})
+			}
+		}
+		x += w
+		i = j
+	}
+}
+
+// linkTarget classifies a link destination as an external URI or a key into l.dests
+func (l *pdfLayout) linkTarget(dest string) (string, string) {
+	if strings.Contains(dest, "://") || strings.HasPrefix(dest, "mailto:") {
+		return dest, ""
+	}
+	file, frag := dest, ""
+	if i := strings.Index(dest, "#"); i >= 0 {
+		file, frag = dest[:i], dest[i+1:]
+	}
+	key := l.key
+	if file != "" {
+		key = path.Clean(path.Join(l.dir, file))
+		if strings.HasSuffix(key, ".html") {
+			key = strings.TrimSuffix(key, ".html") + ".md"
+		}
+	}
+	if frag != "" {
+		key += "#" + frag
+	}
+	return "", key
+}
+
+// resolveLinks turns internal links into links to their laid out destination. Links to
+// a missing heading fall back to the start of its chapter; links outside the book are dropped.
+func (l *pdfLayout) resolveLinks() {
+	for _, p := range l.pending {
+		dest, ok := l.dests[p.target]
+		if !ok {
+			dest, ok = l.dests[strings.SplitN(p.target, "#", 2)[0]]
+		}
+		if ok {
+			p.page.LinkToDest(p.x, p.y, p.w, p.h, dest)
+		}
+	}
+}
+
+// runs flattens the inline children of n into words
+func (l *pdfLayout) runs(n ast.Node, st pdfStyle) []pdfWord {
+	var children []ast.Node
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		children = append(children, c)
+	}
+	return l.inlines(children, st)
+}
+
+// inlines flattens inline nodes into words
+func (l *pdfLayout) inlines(nodes []ast.Node, st pdfStyle) []pdfWord {
+	var words []pdfWord
+	var visit func(c ast.Node, st pdfStyle)
+	walk := func(n ast.Node, st pdfStyle) {
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			visit(c, st)
+		}
+	}
+	add := func(s string, st pdfStyle) {
+		words = append(words, splitPdfWords(s, st)...)
+	}
+	visit = func(c ast.Node, st pdfStyle) {
+		switch v := c.(type) {
+		case *ast.Text:
+			add(string(v.Segment.Value(l.source)), st)
+			if v.HardLineBreak() {
+				words = append(words, pdfWord{br: true})
+			} else if v.SoftLineBreak() {
+				add(" ", st)
+			}
+		case *ast.String:
+			add(string(v.Value), st)
+		case *ast.CodeSpan:
+			code := st
+			code.mono = true
+			add(l.plainText(v), code)
+		case *ast.Emphasis:
+			em := st
+			if v.Level >= 2 {
+				em.bold = true
+			} else {
+				em.italic = true
+			}
+			walk(v, em)
+		case *ast.Link:
+			link := st
+			link.link = string(v.Destination)
+			walk(v, link)
+		case *ast.AutoLink:
+			link := st
+			link.link = string(v.URL(l.source))
+			add(string(v.Label(l.source)), link)
+		case *ast.Image:
+			alt := st
+			alt.italic = true
+			add("["+l.plainText(v)+"]", alt)
+		case *ast.RawHTML:
+			if tag := strings.ToLower(string(v.Segments.Value(l.source))); strings.HasPrefix(tag, "<br") {
+				words = append(words, pdfWord{br: true})
+			}
+		case *extast.TaskCheckBox:
+			if v.IsChecked {
+				add("[x] ", st)
+			} else {
+				add("[ ] ", st)
+			}
+		case *extast.FootnoteLink:
+			add(fmt.Sprintf("[%d]", v.Index), st)
+		case *extast.FootnoteBacklink:
+		default:
+			walk(v, st)
+		}
+	}
+	for _, n := range nodes {
+		visit(n, st)
+	}
+	return words
+}
+
+// imageParagraph lays out a paragraph, placing images that stand directly in it as
+// blocks of their own and the text around them as paragraphs
+func (l *pdfLayout) imageParagraph(p ast.Node, st pdfStyle) {
+	var pending []ast.Node
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		if img, ok := c.(*ast.Image); ok {
+			if embedded := l.image(string(img.Destination)); embedded != nil {
+				l.paragraph(l.inlines(pending, st), l.size)
+				pending = nil
+				l.drawImage(embedded)
+				continue
+			}
+		}
+		pending = append(pending, c)
+	}
+	l.paragraph(l.inlines(pending, st), l.size)
+}
+
+// image returns the embedded image for a link destination relative to the current
+// chapter. Remote images and files that can't be embedded return nil and are shown
+// by their alt text.
+func (l *pdfLayout) image(dest string) *pdf.Image {
+	if dest == "" || strings.Contains(dest, ":") {
+		return nil
+	}
+	if i := strings.IndexAny(dest, "?#"); i >= 0 {
+		dest = dest[:i]
+	}
+	rel := path.Join(l.dir, dest)
+	if strings.HasPrefix(dest, "/") {
+		rel = path.Clean(dest)
+	}
+	file := filepath.Join(l.sourceDir, filepath.FromSlash(rel))
+	if img, ok := l.images[file]; ok {
+		return img
+	}
+	data, err := os.ReadFile(file)
+	var img *pdf.Image
+	if err == nil {
+		img, err = l.doc.AddImage(data)
+	}
+	if err != nil {
+		l.warnings = append(l.warnings, fmt.Sprintf("'%s': image '%s' is shown as its alt text: %v", l.key, dest, err))
+	}
+	l.images[file] = img
+	return img
+}
+
+// drawImage lays out an image at 96 dpi, scaled down to fit the page
+func (l *pdfLayout) drawImage(img *pdf.Image) {
+	w, h := float64(img.Width)*0.75, float64(img.Height)*0.75
+	maxW, maxH := l.contentWidth()-l.indent, l.top()-l.margin
+	if w > maxW {
+		w, h = maxW, h*maxW/w
+	}
+	if h > maxH {
+		w, h = w*maxH/h, maxH
+	}
+	l.ensure(h)
+	l.page.Image(img, l.margin+l.indent, l.y-h, w, h)
+	l.y -= h + l.size*0.6
+}
+
+// htmlBlock lays out the text of a raw HTML block as paragraphs, and its images
+func (l *pdfLayout) htmlBlock(b *ast.HTMLBlock) {
+	var raw strings.Builder
+	lines := b.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		raw.Write(seg.Value(l.source))
+	}
+	if b.HasClosure() {
+		raw.Write(b.ClosureLine.Value(l.source))
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(raw.String()), body)
+	if err != nil {
+		return
+	}
+
+	st := pdfStyle{size: l.size}
+	var words []pdfWord
+	flush := func() {
+		if len(words) > 0 {
+			l.paragraph(words, l.size)
+			l.y -= l.size * 0.6
+			words = nil
+		}
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			// Collapse whitespace like a browser, keeping it between adjacent elements
+			words = append(words, splitPdfWords(pdfSpaceRegex.ReplaceAllString(n.Data, " "), st)...)
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Script, atom.Style, atom.Template:
+				return
+			case atom.Br:
+				words = append(words, pdfWord{br: true})
+				return
+			case atom.Img:
+				for _, a := range n.Attr {
+					if a.Key == "src" {
+						if img := l.image(a.Val); img != nil {
+							flush()
+							l.drawImage(img)
+						}
+					}
+				}
+				return
+			}
+			block := pdfHTMLBlocks[n.DataAtom]
+			if block {
+				flush()
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			if block {
+				flush()
+			}
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	flush()
+}
+
+// pdfSpaceRegex matches the whitespace runs of HTML text
+var pdfSpaceRegex = regexp.MustCompile(`\s+`)
+
+// pdfHTMLBlocks are the HTML elements whose text starts a new paragraph
+var pdfHTMLBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Aside: true,
+	atom.Blockquote: true, atom.Details: true, atom.Summary: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Li: true, atom.Tr: true, atom.Table: true, atom.Pre: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// checkText records a warning if text of the named source uses characters the standard
+// PDF fonts can't show
+func (l *pdfLayout) checkText(name, text string) {
+	missing := pdf.Unsupported(text)
+	if len(missing) == 0 {
+		return
+	}
+	list := string(missing)
+	if len(missing) > 10 {
+		list = string(missing[:10]) + "…"
+	}
+	l.warnings = append(l.warnings, fmt.Sprintf("'%s' uses characters the standard PDF fonts can't show (%s); they appear as '?'", name, list))
+}
+
+// plainText returns the text content of n without formatting
+func (l *pdfLayout) plainText(n ast.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch v := c.(type) {
+		case *ast.Text:
+			sb.Write(v.Segment.Value(l.source))
+			if v.SoftLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(v.Value)
+		default:
+			sb.WriteString(l.plainText(v))
+		}
+	}
+	return sb.String()
+}
+
+// splitPdfWords splits text into alternating words and spaces
+func splitPdfWords(s string, st pdfStyle) []pdfWord {
+	var words []pdfWord
+	start := 0
+	for i, r := range s {
+		if r == ' ' || r == '\n' || r == '\t' {
+			if i > start {
+				words = append(words, pdfWord{text: s[start:i], style: st})
+			}
+			words = append(words, pdfWord{text: " ", style: st, space: true})
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		words = append(words, pdfWord{text: s[start:], style: st})
+	}
+	return words
+}
+
+// wrapPdfWords breaks words into lines no wider than width. Adjacent words without a
+// space between them (e.g. a bold word and the comma after it) stay on the same line;
+// a single piece wider than a whole line is split between characters.
+func wrapPdfWords(words []pdfWord, width float64) [][]pdfWord {
+	var lines [][]pdfWord
+	var cur []pdfWord
+	curW := 0.0
+	flush := func() {
+		for len(cur) > 0 && cur[len(cur)-1].space {
+			cur = cur[:len(cur)-1]
+		}
+		lines = append(lines, cur)
+		cur, curW = nil, 0
+	}
+
+	for i := 0; i < len(words); {
+		w := words[i]
+		switch {
+		case w.br:
+			flush()
+			i++
+			continue
+		case w.space:
+			if len(cur) > 0 {
+				cur = append(cur, w)
+				curW += w.width()
+			}
+			i++
+			continue
+		}
+
+		// Group words up to the next space or break
+		j := i
+		groupW := 0.0
+		for j < len(words) && !words[j].space && !words[j].br {
+			groupW += words[j].width()
+			j++
+		}
+		if curW+groupW > width && len(cur) > 0 {
+			flush()
+		}
+		if groupW <= width {
+			cur = append(cur, words[i:j]...)
+			curW += groupW
+			i = j
+			continue
+		}
+		for _, w := range words[i:j] {
+			for _, r := range w.text {
+				piece := pdfWord{text: string(r), style: w.style}
+				if curW+piece.width() > width && len(cur) > 0 {
+					flush()
+				}
+				cur = append(cur, piece)
+				curW += piece.width()
+			}
+		}
+		i = j
+	}
+	if len(cur) > 0 {
+		flush()
+	}
+	return lines
+}
+
+// lineWidth returns the width of a laid out line
+func lineWidth(line []pdfWord) float64 {
+	total := 0.0
+	for _, w := range line {
+		total += w.width()
+	}
+	return total
+}
+
+// frontMatter inserts a title page and the table of contents before the chapters, then
+// numbers every page after the title page
+func (l *pdfLayout) frontMatter(title string, authors []string, description string) {
+	width, height := l.doc.Size()
+	center := func(p *pdf.Page, y float64, line []pdfWord) {
+		l.page = p
+		l.drawWords(line, (width-lineWidth(line))/2, y)
+	}
+
+	titlePage := l.doc.InsertPage(0)
+	y := height * 0.62
+	titleSize := l.size * 2.4
+	for _, line := range wrapPdfWords(splitPdfWords(title, pdfStyle{size: titleSize, bold: true}), l.contentWidth()) {
+		center(titlePage, y, line)
+		y -= titleSize * 1.3
+	}
+	if len(authors) > 0 {
+		y -= l.size
+		center(titlePage, y, splitPdfWords(strings.Join(authors, ", "), pdfStyle{size: l.size * 1.3}))
+		y -= l.size * 2
+	}
+	if description != "" {
+		y -= l.size
+		for _, line := range wrapPdfWords(splitPdfWords(description, pdfStyle{size: l.size, italic: true}), l.contentWidth()*0.8) {
+			center(titlePage, y, line)
+			y -= l.size * 1.35
+		}
+	}
+
+	if len(l.toc) > 0 {
+		l.tableOfContents()
+	}
+
+	pages := l.doc.Pages()
+	for i, p := range pages[1:] {
+		s := strconv.Itoa(i + 2)
+		p.SetFillColor(0.4, 0.4, 0.4)
+		p.Text((width-pdf.TextWidth(pdf.Regular, l.size*0.8, s))/2, l.margin/2, pdf.Regular, l.size*0.8, s)
+		p.SetFillColor(0, 0, 0)
+	}
+}
+
+// tableOfContents inserts the contents pages after the title page. Each entry links to
+// its chapter and shows the page number it starts on.
+func (l *pdfLayout) tableOfContents() {
+	headingSize := l.size * pdfHeadingScale[1]
+	lh := l.size * 1.6
+	perPage := int((l.top() - l.margin - headingSize*2) / lh)
+	if perPage < 1 {
+		perPage = 1
+	}
+
+	var pages []*pdf.Page
+	for i := 0; i*perPage < len(l.toc); i++ {
+		pages = append(pages, l.doc.InsertPage(1+i))
+	}
+	right := l.margin + l.contentWidth()
+	pages[0].Text(l.margin, l.top()-headingSize, pdf.Bold, headingSize, "Contents")
+
+	for i, e := range l.toc {
+		p := pages[i/perPage]
+		y := l.top() - headingSize*2 - float64(i%perPage+1)*lh
+		x := l.margin + float64(e.level)*14
+		font := pdf.Regular
+		if e.part {
+			font = pdf.Bold
+		}
+
+		number := ""
+		if !e.part {
+			number = strconv.Itoa(l.doc.PageNumber(e.dest.Page))
+		}
+		numberW := pdf.TextWidth(pdf.Regular, l.size, number)
+		entry := truncatePdfText(e.title, font, l.size, right-x-numberW-16)
+		entryW := pdf.TextWidth(font, l.size, entry)
+
+		p.Text(x, y, font, l.size, entry)
+		if number != "" {
+			dotW := pdf.TextWidth(pdf.Regular, l.size, " .")
+			if dots := int((right - numberW - 4 - (x + entryW + 4)) / dotW); dots > 0 {
+				p.SetFillColor(0.6, 0.6, 0.6)
+				p.Text(right-numberW-4-float64(dots)*dotW, y, pdf.Regular, l.size, strings.Repeat(" .", dots))
+				p.SetFillColor(0, 0, 0)
+			}
+			p.Text(right-numberW, y, pdf.Regular, l.size, number)
+		}
+		p.LinkToDest(x, y-l.size*0.3, right-x, lh, e.dest)
+	}
+}
+
+// truncatePdfText shortens s with an ellipsis so it fits within width
+func truncatePdfText(s string, font pdf.Font, size, width float64) string {
+	if pdf.TextWidth(font, size, s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.TextWidth(font, size, string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
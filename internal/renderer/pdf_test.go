@@ -0,0 +1,162 @@
+package renderer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pdfPageText returns the decompressed content stream of every page
+func pdfPageText(t *testing.T, data []byte) []string {
+	var pages []string
+	for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		pages = append(pages, string(content))
+	}
+	return pages
+}
+
+func TestPdfRender(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Title = "Print Me"
+	cfg.Book.Authors = []string{"Jane Doe"}
+
+	intro := models.NewChapter("Introduction", "# Introduction\n\nRead the [guide](guide/one.md#details) and *more*.\n", "intro.md", nil)
+	one := models.NewChapter("One", "# One\n\n## Details\n\n- item\n\n```\ncode (line)\n```\n", "guide/one.md", nil)
+	one.Number = &models.SectionNumber{Parts: []int{1}}
+	book := models.NewBookWithItems([]models.BookItem{
+		intro,
+		&models.PartTitle{Title: "Guide"},
+		one,
+		models.NewDraftChapter("Later", nil),
+	})
+
+	out := t.TempDir()
+	require.NoError(t, NewPdfRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}))
+
+	data, err := os.ReadFile(filepath.Join(out, "print-me.pdf"))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+
+	// Title page, contents, then one page per chapter
+	pages := pdfPageText(t, data)
+	require.Len(t, pages, 4)
+	assert.Contains(t, pages[0], "(Print Me) Tj")
+	assert.Contains(t, pages[0], "(Jane Doe) Tj")
+
+	assert.Contains(t, pages[1], "(Contents) Tj")
+	assert.Contains(t, pages[1], "(Introduction) Tj")
+	assert.Contains(t, pages[1], "(Guide) Tj")
+	assert.Contains(t, pages[1], "(1. One) Tj")
+	assert.Contains(t, pages[1], "(4) Tj")
+	assert.NotContains(t, strings.Join(pages, ""), "Later")
+
+	assert.Contains(t, pages[2], "(guide) Tj")
+	assert.Contains(t, pages[3], `(code \(line\)) Tj`)
+	assert.Contains(t, pages[3], "(\x95) Tj")
+
+	// Bookmarks for the part, each chapter and the Details heading (titles are UTF-16)
+	s := string(data)
+	assert.Contains(t, s, "/PageMode /UseOutlines")
+	for _, title := range []string{"Introduction", "Guide", "1. One", "Details"} {
+		assert.Contains(t, s, utf16Title(title), title)
+	}
+	// TOC entries plus the in-text link to the guide
+	assert.Equal(t, 4, strings.Count(s, "/Subtype /Link"))
+}
+
+func TestPdfRenderImagesAndHTML(t *testing.T) {
+	root := t.TempDir()
+	var dot bytes.Buffer
+	require.NoError(t, png.Encode(&dot, image.NewNRGBA(image.Rect(0, 0, 4, 2))))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src", "img"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "img", "dot.png"), dot.Bytes(), 0644))
+
+	content := "# One\n\nBefore ![dot](../img/dot.png) after ![gone](missing.png).\n\n<div>Raw <b>html</b> text</div>\n\n日本語\n"
+	book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", content, "guide/one.md", nil)})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	out := t.TempDir()
+	cfg := config.NewDefaultConfig()
+	cfg.Output["pdf"] = map[string]interface{}{"filename": "book.pdf"}
+	ctx := &RenderContext{Root: root, DestDir: out, Book: book, Config: cfg, SourceDir: filepath.Join(root, "src")}
+	require.NoError(t, NewPdfRenderer().Render(ctx))
+	data, err := os.ReadFile(filepath.Join(out, "book.pdf"))
+	require.NoError(t, err)
+
+	s := string(data)
+	assert.Contains(t, s, "/Subtype /Image /Width 4 /Height 2")
+	assert.Contains(t, s, "/SMask")
+	page := strings.Join(pdfPageText(t, data), "")
+	assert.Contains(t, page, "/Im1 Do")
+	assert.Contains(t, page, "(Before) Tj")
+	assert.Contains(t, page, "(Raw html text) Tj")
+	assert.Contains(t, page, "[gone]")
+
+	assert.Contains(t, logs.String(), "image 'missing.png' is shown as its alt text")
+	assert.Contains(t, logs.String(), "'guide/one.md' uses characters the standard PDF fonts can't show (日本語)")
+}
+
+func TestPdfRenderPageSize(t *testing.T) {
+	book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "# One", "one.md", nil)})
+
+	cfg := config.NewDefaultConfig()
+	cfg.Output["pdf"] = map[string]interface{}{"page-size": "letter", "filename": "out.pdf"}
+	out := t.TempDir()
+	require.NoError(t, NewPdfRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg}))
+	data, err := os.ReadFile(filepath.Join(out, "out.pdf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "/MediaBox [0 0 612 792]")
+
+	cfg.Output["pdf"] = map[string]interface{}{"page-size": "tabloid"}
+	err = NewPdfRenderer().Render(&RenderContext{Root: ".", DestDir: out, Book: book, Config: cfg})
+	assert.ErrorContains(t, err, `unknown output.pdf.page-size "tabloid"`)
+}
+
+func TestWrapPdfWords(t *testing.T) {
+	st := pdfStyle{size: 10}
+	bold := pdfStyle{size: 10, bold: true}
+	words := append(splitPdfWords("aaa bbb ", st), splitPdfWords("ccc", bold)...)
+	words = append(words, splitPdfWords(", ddd", st)...)
+
+	// Wide enough for "aaa bbb ccc" but not for the comma after it
+	width := pdfWord{text: "aaa bbb ", style: st}.width() + pdfWord{text: "ccc", style: bold}.width() + 0.5
+	var got []string
+	for _, line := range wrapPdfWords(words, width) {
+		var sb strings.Builder
+		for _, w := range line {
+			sb.WriteString(w.text)
+		}
+		got = append(got, sb.String())
+	}
+	// "ccc," is kept together even though the comma has a different style
+	assert.Equal(t, []string{"aaa bbb", "ccc, ddd"}, got)
+}
+
+// utf16Title encodes a bookmark title the way the PDF writer does
+func utf16Title(s string) string {
+	b := []byte{0xFE, 0xFF}
+	for _, r := range s {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return string(b)
+}
@@ -82,7 +82,7 @@ func (r *HtmlRenderer) generateRedirects(ctx *RenderContext) error {
 		}
 		outPath := filepath.Join(ctx.DestDir, filepath.FromSlash(srcBase))
 		// Do not overwrite existing content page
-		if _, err := os.Stat(outPath); err == nil {
+		if _, err := ctx.output().Stat(outPath); err == nil {
 			continue
 		}
 		fragJSON, _ := json.Marshal(g.fragments)
@@ -94,10 +94,10 @@ func (r *HtmlRenderer) generateRedirects(ctx *RenderContext) error {
 		if err != nil {
 			return err
 		}
-		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		if err := ctx.output().MkdirAll(filepath.Dir(outPath)); err != nil {
 			return err
 		}
-		if err := os.WriteFile(outPath, []byte(out), 0644); err != nil {
+		if err := ctx.output().WriteFile(outPath, []byte(out)); err != nil {
 			return err
 		}
 	}
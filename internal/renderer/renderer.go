@@ -10,7 +10,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/aymerick/raymond"
 	"github.com/geocine/geopub/internal/config"
@@ -30,16 +32,49 @@ type RenderContext struct {
 	SourceDir string
 	// If non-empty, pages inject an SSE live-reload client targeting this path.
 	LiveReloadEndpointPath string
+	// BasePath is the URL path the site is served under; the 404 page resolves its links
+	// against it. Empty means "/".
+	BasePath string
 	// AssetsFS optionally provides embedded front-end assets (expects paths under "frontend/")
 	AssetsFS fs.FS
 	// ResourceMap provides mapping original -> fingerprinted asset paths for templates
 	ResourceMap map[string]string
+	// Cache optionally skips regenerating outputs whose inputs are unchanged since the last build
+	Cache *BuildCache
+	// Jobs limits how many chapters are rendered concurrently (0 means one per CPU)
+	Jobs int
+	// Output receives the rendered files; nil writes them to disk
+	Output OutputFS
+}
+
+// themeDir returns the theme/ directory of the book, which overrides the built-in templates and assets
+func (ctx *RenderContext) themeDir() string {
+	return filepath.Join(ctx.Root, "theme")
+}
+
+// basePath returns the URL path the site is served under
+func (ctx *RenderContext) basePath() string {
+	if ctx.BasePath == "" {
+		return "/"
+	}
+	return ctx.BasePath
 }
 
 // HtmlRenderer renders a book to HTML
 type HtmlRenderer struct {
-	markdown goldmark.Markdown
-	book     *models.Book // Store book reference for nav generation
+	markdown   goldmark.Markdown
+	book       *models.Book // Store book reference for nav generation
+	pageInputs string       // Hash of the config, templates and assets shared by all pages
+	tagPages   *tagPages    // Tag pages of the current render; nil when there are none
+
+	mu        sync.Mutex
+	converted map[*models.Chapter]*convertedChapter // Markdown converted once per render
+}
+
+// convertedChapter is the HTML and headings of a chapter's converted Markdown
+type convertedChapter struct {
+	html     string
+	headings []HeadingInfo
 }
 
 // NewHtmlRenderer creates a new HTML renderer
@@ -57,12 +92,18 @@ func NewHtmlRenderer() *HtmlRenderer {
 	return &HtmlRenderer{markdown: md}
 }
 
+// Name returns the renderer name
+func (r *HtmlRenderer) Name() string {
+	return "html"
+}
+
 // Render renders the book to HTML
 func (r *HtmlRenderer) Render(ctx *RenderContext) error {
 	r.book = ctx.Book // Store for nav generation
+	r.converted = map[*models.Chapter]*convertedChapter{}
 
 	// Create output directory
-	if err := os.MkdirAll(ctx.DestDir, 0755); err != nil {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
@@ -70,17 +111,19 @@ func (r *HtmlRenderer) Render(ctx *RenderContext) error {
 	if err := r.copyAssets(ctx); err != nil {
 		return fmt.Errorf("failed to copy assets: %w", err)
 	}
+	r.pageInputs = pageInputsHash(ctx)
+
+	// Name the tag pages up front, since chapter pages link to them
+	if err := r.planTagPages(ctx); err != nil {
+		return fmt.Errorf("failed to render tag pages: %w", err)
+	}
 
 	// Collect all chapters for TOC and navigation
 	allChapters := r.collectChapters(ctx.Book)
 
 	// Render all chapters and their nested items
-	for _, item := range ctx.Book.Items {
-		if ch, ok := item.(*models.Chapter); ok {
-			if err := r.renderChapterRecursive(ctx, ch, allChapters); err != nil {
-				return fmt.Errorf("failed to render chapter: %w", err)
-			}
-		}
+	if err := r.renderChapters(ctx, allChapters); err != nil {
+		return fmt.Errorf("failed to render chapter: %w", err)
 	}
 
 	// Create index.html
@@ -93,6 +136,11 @@ func (r *HtmlRenderer) Render(ctx *RenderContext) error {
 		return fmt.Errorf("failed to render extra pages: %w", err)
 	}
 
+	// Create the tag pages from chapter frontmatter
+	if err := r.renderTagPages(ctx); err != nil {
+		return fmt.Errorf("failed to render tag pages: %w", err)
+	}
+
 	// Generate search index
 	if err := r.generateSearchIndex(ctx); err != nil {
 		return fmt.Errorf("failed to generate search index: %w", err)
@@ -106,23 +154,74 @@ func (r *HtmlRenderer) Render(ctx *RenderContext) error {
 	return nil
 }
 
-// renderChapterRecursive renders a chapter and its sub-chapters
-func (r *HtmlRenderer) renderChapterRecursive(ctx *RenderContext, chapter *models.Chapter, allChapters []*models.Chapter) error {
-	// Render this chapter
-	if err := r.renderChapter(ctx, chapter, allChapters); err != nil {
-		return err
+// renderChapters renders chapters concurrently with up to ctx.Jobs workers.
+// The first error stops any remaining chapters from being started.
+func (r *HtmlRenderer) renderChapters(ctx *RenderContext, chapters []*models.Chapter) error {
+	jobs := ctx.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > len(chapters) {
+		jobs = len(chapters)
 	}
 
-	// Recursively render sub-chapters
-	for _, item := range chapter.SubItems {
-		if subCh, ok := item.(*models.Chapter); ok {
-			if err := r.renderChapterRecursive(ctx, subCh, allChapters); err != nil {
-				return err
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr != nil
+	}
+
+	work := make(chan *models.Chapter)
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range work {
+				if err := r.renderChapter(ctx, ch, chapters); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+				}
 			}
+		}()
+	}
+	for _, ch := range chapters {
+		if failed() {
+			break
 		}
+		work <- ch
 	}
+	close(work)
+	wg.Wait()
 
-	return nil
+	return firstErr
+}
+
+// chapterHTML returns the converted Markdown of a chapter, converting it on first use
+// so the page, print page and search index share a single conversion
+func (r *HtmlRenderer) chapterHTML(ch *models.Chapter) (string, []HeadingInfo) {
+	r.mu.Lock()
+	c, ok := r.converted[ch]
+	r.mu.Unlock()
+	if ok {
+		return c.html, c.headings
+	}
+
+	html, headings := r.convertMarkdown(ch.Content)
+	r.mu.Lock()
+	if r.converted == nil {
+		r.converted = map[*models.Chapter]*convertedChapter{}
+	}
+	r.converted[ch] = &convertedChapter{html: html, headings: headings}
+	r.mu.Unlock()
+	return html, headings
 }
 
 // collectChapters flattens all chapters for navigation
@@ -193,8 +292,7 @@ func (r *HtmlRenderer) convertMarkdown(content string) (string, []HeadingInfo) {
 	// Extract headings and add unique IDs
 	var headings []HeadingInfo
 	headingRegex := regexp.MustCompile(`<h([1-6])>(.*?)</h[1-6]>`)
-	used := map[string]bool{}
-	nextSuffix := map[string]int{}
+	ids := newHeadingIDs()
 	html = headingRegex.ReplaceAllStringFunc(html, func(match string) string {
 		parts := headingRegex.FindStringSubmatch(match)
 		if len(parts) < 3 {
@@ -204,24 +302,7 @@ func (r *HtmlRenderer) convertMarkdown(content string) (string, []HeadingInfo) {
 		text := parts[2]
 		plain := regexp.MustCompile(`<[^>]+>`).ReplaceAllString(text, "")
 		plain = htmlutil.UnescapeString(plain)
-		base := slugify(plain)
-		id := base
-		if used[id] {
-			for {
-				nextSuffix[base]++
-				cand := base
-				if cand != "" {
-					cand = cand + "-" + fmt.Sprintf("%d", nextSuffix[base])
-				} else {
-					cand = "-" + fmt.Sprintf("%d", nextSuffix[base])
-				}
-				if !used[cand] {
-					id = cand
-					break
-				}
-			}
-		}
-		used[id] = true
+		id := ids.next(plain)
 		if level != "1" {
 			headings = append(headings, HeadingInfo{Level: level, Text: plain, ID: id})
 		}
@@ -241,9 +322,9 @@ func (r *HtmlRenderer) convertMarkdown(content string) (string, []HeadingInfo) {
 
 // HeadingInfo represents a heading in the document
 type HeadingInfo struct {
-	Level string
-	Text  string
-	ID    string
+	Level string `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
 }
 
 // slugify converts text to URL slug using geopub-compatible algorithm
@@ -259,6 +340,30 @@ func slugify(text string) string {
 	return s
 }
 
+// headingIDs hands out the IDs of the headings of a chapter: the slug of the heading
+// text, with a numbered suffix for repeats. Every backend that links to headings uses
+// it, so chapter.md#id links resolve the same way in all of them.
+type headingIDs struct {
+	used       map[string]bool
+	nextSuffix map[string]int
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{used: map[string]bool{}, nextSuffix: map[string]int{}}
+}
+
+// next returns the ID for a heading with the given plain text
+func (h *headingIDs) next(text string) string {
+	base := slugify(text)
+	id := base
+	for h.used[id] {
+		h.nextSuffix[base]++
+		id = fmt.Sprintf("%s-%d", base, h.nextSuffix[base])
+	}
+	h.used[id] = true
+	return id
+}
+
 // renderTOCItemAbsolute recursively renders TOC items with absolute paths
 func (r *HtmlRenderer) renderTOCItemAbsolute(buf *strings.Builder, ch *models.Chapter, depth int) {
 	if ch.Path == nil {
@@ -317,9 +422,6 @@ func getGitInfo(ctx *RenderContext, chapterPath string) (gitUrl, gitEditUrl, git
 
 // renderChapter renders a single chapter to an HTML file
 func (r *HtmlRenderer) renderChapter(ctx *RenderContext, chapter *models.Chapter, allChapters []*models.Chapter) error {
-	// Convert markdown to HTML with heading anchors
-	htmlContent, _ := r.convertMarkdown(chapter.Content)
-
 	// Generate filename preserving nested structure
 	path := ""
 	if chapter.Path != nil {
@@ -329,7 +431,7 @@ func (r *HtmlRenderer) renderChapter(ctx *RenderContext, chapter *models.Chapter
 	outPath := filepath.Join(ctx.DestDir, path+".html")
 
 	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+	if err := ctx.output().MkdirAll(filepath.Dir(outPath)); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
@@ -364,6 +466,16 @@ func (r *HtmlRenderer) renderChapter(ctx *RenderContext, chapter *models.Chapter
 		nextData = &struct{ Link string }{Link: strings.ReplaceAll(strings.TrimSuffix(*nextCh.Path, ".md")+".html", "\\", "/")}
 	}
 
+	// Convert markdown to HTML with heading anchors. This happens even for cached pages
+	// since the print page and search index need the result too.
+	htmlContent, _ := r.chapterHTML(chapter)
+
+	// Skip the page if neither it nor anything it depends on changed since the last build
+	cacheKey := hashInputs(r.pageInputs, chapter.Name, path, chapter.Content, fmt.Sprint(prevData), fmt.Sprint(nextData), fmt.Sprint(chapter.Metadata), fmt.Sprint(r.chapterTagLinks(chapter, "")))
+	if ctx.Cache.Fresh(ctx.output(), outPath, cacheKey) {
+		return nil
+	}
+
 	// Get git repository info
 	gitUrl, gitEditUrl, gitIcon, gitIconClass := getGitInfo(ctx, *chapter.Path)
 
@@ -395,15 +507,17 @@ func (r *HtmlRenderer) renderChapter(ctx *RenderContext, chapter *models.Chapter
 		GitRepositoryIcon:      gitIcon,
 		GitRepositoryIconClass: gitIconClass,
 	}
+	r.applyChapterMetadata(ctx, chapter, pd)
 	pageHTML, err := renderPageWithHbs(ctx, pd)
 	if err != nil {
 		return fmt.Errorf("failed to render HBS page: %w", err)
 	}
 
 	// Write file
-	if err := os.WriteFile(outPath, []byte(pageHTML), 0644); err != nil {
+	if err := ctx.output().WriteFile(outPath, []byte(pageHTML)); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+	ctx.Cache.Record(outPath, cacheKey)
 
 	return nil
 }
@@ -421,9 +535,7 @@ func (r *HtmlRenderer) renderIndex(ctx *RenderContext) error {
 
 	var htmlContent string
 	if firstCh != nil && firstCh.Path != nil {
-		var headings []HeadingInfo
-		htmlContent, headings = r.convertMarkdown(firstCh.Content)
-		_ = headings // unused for index
+		htmlContent, _ = r.chapterHTML(firstCh)
 	} else {
 		htmlContent = `<h1 id="introduction"><a class="header" href="#introduction">Introduction</a></h1>
 <p>Select a chapter to begin reading.</p>`
@@ -475,18 +587,21 @@ func (r *HtmlRenderer) renderIndex(ctx *RenderContext) error {
 		GitRepositoryIcon:      gitIcon,
 		GitRepositoryIconClass: gitIconClass,
 	}
+	if firstCh != nil {
+		r.applyChapterMetadata(ctx, firstCh, pd)
+	}
 	pageHTML, err := renderPageWithHbs(ctx, pd)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(ctx.DestDir, "index.html"), []byte(pageHTML), 0644)
+	return writeCached(ctx, filepath.Join(ctx.DestDir, "index.html"), []byte(pageHTML))
 }
 
 // renderExtraPages generates print.html, 404.html, etc.
 func (r *HtmlRenderer) renderExtraPages(ctx *RenderContext) error {
 	// .nojekyll - tells GitHub Pages to serve the site as-is
 	nojekyllContent := "This file makes sure that Github Pages doesn't process geopub's output.\n"
-	if err := os.WriteFile(filepath.Join(ctx.DestDir, ".nojekyll"), []byte(nojekyllContent), 0644); err != nil {
+	if err := ctx.output().WriteFile(filepath.Join(ctx.DestDir, ".nojekyll"), []byte(nojekyllContent)); err != nil {
 		return err
 	}
 
@@ -503,7 +618,7 @@ func (r *HtmlRenderer) renderExtraPages(ctx *RenderContext) error {
 		PreferredDarkTheme:     ctx.Config.GetString("output.html.preferred-dark-theme", "navy"),
 		TextDirection:          "ltr",
 		Title:                  fmt.Sprintf("%s - %s", "Page not found", ctx.Config.Book.Title),
-		BaseUrl:                "/",
+		BaseUrl:                ctx.basePath(),
 		Description:            ctx.Config.Book.Description,
 		FaviconSvg:             ctx.Config.GetString("output.html.favicon-svg", "") != "",
 		FaviconPng:             ctx.Config.GetString("output.html.favicon-png", "") != "",
@@ -526,7 +641,7 @@ func (r *HtmlRenderer) renderExtraPages(ctx *RenderContext) error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(ctx.DestDir, "404.html"), []byte(notFoundHTML), 0644); err != nil {
+	if err := writeCached(ctx, filepath.Join(ctx.DestDir, "404.html"), []byte(notFoundHTML)); err != nil {
 		return err
 	}
 
@@ -548,7 +663,7 @@ func (r *HtmlRenderer) renderExtraPages(ctx *RenderContext) error {
 	// CNAME support
 	cname := ctx.Config.GetString("output.renderer.cname", "")
 	if cname != "" {
-		if err := os.WriteFile(filepath.Join(ctx.DestDir, "CNAME"), []byte(cname), 0644); err != nil {
+		if err := ctx.output().WriteFile(filepath.Join(ctx.DestDir, "CNAME"), []byte(cname)); err != nil {
 			return err
 		}
 	}
@@ -563,7 +678,7 @@ func (r *HtmlRenderer) renderTocPage(ctx *RenderContext) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(ctx.DestDir, "toc.html"), []byte(rendered), 0644)
+	return writeCached(ctx, filepath.Join(ctx.DestDir, "toc.html"), []byte(rendered))
 }
 
 // generateTocListHTML builds the <ol class="chapter"> list used by toc.html and toc.js
@@ -607,7 +722,7 @@ func (r *HtmlRenderer) renderTocJS(ctx *RenderContext) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(ctx.DestDir, "toc.js"), []byte(rendered), 0644)
+	return writeCached(ctx, filepath.Join(ctx.DestDir, "toc.js"), []byte(rendered))
 }
 
 // renderTocItemForPage renders a TOC item with proper numbering and nesting for toc.html
@@ -711,7 +826,7 @@ func (r *HtmlRenderer) renderPrintPage(ctx *RenderContext) error {
 		}
 		isFirst = false
 
-		htmlContent, _ := r.convertMarkdown(ch.Content)
+		htmlContent, _ := r.chapterHTML(ch)
 		combined.WriteString(htmlContent)
 	}
 
@@ -746,7 +861,7 @@ func (r *HtmlRenderer) renderPrintPage(ctx *RenderContext) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(ctx.DestDir, "print.html"), []byte(pageHTML), 0644)
+	return writeCached(ctx, filepath.Join(ctx.DestDir, "print.html"), []byte(pageHTML))
 }
 
 // htmlEscape is a minimal HTML escaper for titles
@@ -777,8 +892,8 @@ func (r *HtmlRenderer) copyAssets(ctx *RenderContext) error {
 	// readThemeOverride checks if a file exists in theme/ directory and reads it
 	readThemeOverride := func(themePath string) ([]byte, bool) {
 		// Try reading from theme directory (local filesystem only)
-		if _, err := os.Stat("theme"); err == nil {
-			fullPath := filepath.Join("theme", themePath)
+		if _, err := os.Stat(ctx.themeDir()); err == nil {
+			fullPath := filepath.Join(ctx.themeDir(), themePath)
 			if data, err := os.ReadFile(fullPath); err == nil {
 				// Replace mdbook- prefixes with geopub- for compatibility
 				ext := strings.ToLower(filepath.Ext(themePath))
@@ -912,12 +1027,17 @@ func (r *HtmlRenderer) copyAssets(ctx *RenderContext) error {
 		}
 		dest := mapping[a.key]
 		out := filepath.Join(ctx.DestDir, filepath.FromSlash(dest))
-		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		contentHash := hashInputs(string(content))
+		if ctx.Cache.Fresh(ctx.output(), out, contentHash) {
+			continue
+		}
+		if err := ctx.output().MkdirAll(filepath.Dir(out)); err != nil {
 			return err
 		}
-		if err := os.WriteFile(out, content, 0o644); err != nil {
+		if err := ctx.output().WriteFile(out, content); err != nil {
 			return err
 		}
+		ctx.Cache.Record(out, contentHash)
 	}
 
 	ctx.ResourceMap = mapping
@@ -939,6 +1059,37 @@ func (r *HtmlRenderer) copyNonMarkdown(ctx *RenderContext) error {
 		return nil
 	}
 
+	return walkNonMarkdown(srcRoot, func(rel, path string) error {
+		// Destination path
+		dst := filepath.Join(dstRoot, rel)
+		// Skip files whose size and modification time are unchanged since the last copy
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		stamp := hashInputs(fmt.Sprint(info.Size()), info.ModTime().UTC().String())
+		if ctx.Cache.Fresh(ctx.output(), dst, stamp) {
+			return nil
+		}
+		// Ensure directory
+		if err := ctx.output().MkdirAll(filepath.Dir(dst)); err != nil {
+			return err
+		}
+		// Copy file
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := ctx.output().WriteFile(dst, data); err != nil {
+			return err
+		}
+		ctx.Cache.Record(dst, stamp)
+		return nil
+	})
+}
+
+// walkNonMarkdown calls fn for every non-Markdown file under srcRoot with its path relative to srcRoot
+func walkNonMarkdown(srcRoot string, fn func(rel, path string) error) error {
 	return filepath.Walk(srcRoot, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
@@ -956,18 +1107,7 @@ func (r *HtmlRenderer) copyNonMarkdown(ctx *RenderContext) error {
 		if err != nil {
 			return nil
 		}
-		// Destination path
-		dst := filepath.Join(dstRoot, rel)
-		// Ensure directory
-		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-			return err
-		}
-		// Copy file
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		return os.WriteFile(dst, data, 0o644)
+		return fn(rel, path)
 	})
 }
 
@@ -998,8 +1138,8 @@ func (r *HtmlRenderer) generateSearchIndex(ctx *RenderContext) error {
 			breadcrumb = parentBreadcrumb + " » " + ch.Name
 		}
 
-		// Convert markdown to HTML first to extract headings
-		htmlContent, headings := r.convertMarkdown(ch.Content)
+		// Reuse the chapter's converted HTML to extract headings
+		htmlContent, headings := r.chapterHTML(ch)
 		plainText := r.stripHTML(htmlContent)
 
 		// Add the main chapter document
@@ -1079,7 +1219,7 @@ func (r *HtmlRenderer) generateSearchIndex(ctx *RenderContext) error {
 	searchIndexPath := filepath.Join(ctx.DestDir, "searchindex.js")
 	content := fmt.Sprintf("window.search = Object.assign(window.search, JSON.parse('%s'));", jsonStr)
 
-	if err := os.WriteFile(searchIndexPath, []byte(content), 0644); err != nil {
+	if err := writeCached(ctx, searchIndexPath, []byte(content)); err != nil {
 		return fmt.Errorf("failed to write searchindex.js: %w", err)
 	}
 
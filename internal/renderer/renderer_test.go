@@ -1,11 +1,18 @@
 package renderer
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/geocine/geopub/internal/config"
 	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSlugify(t *testing.T) {
@@ -153,3 +160,233 @@ func TestRenderTocItemForJSWithNumber(t *testing.T) {
 	assert.Contains(t, result, `href="ch1.html"`)
 	assert.Contains(t, result, `Chapter 1</a>`)
 }
+
+func TestNewBackend(t *testing.T) {
+	cfg, err := config.LoadFromString(`
+[output.html]
+
+[output.linkcheck]
+
+[output.pdf]
+command = "node render-pdf.js"
+`)
+	assert.NoError(t, err)
+
+	// Registered backend
+	_, ok := NewBackend("html", cfg).(*HtmlRenderer)
+	assert.True(t, ok)
+
+	// Unregistered backend falls back to geopub-<name>
+	ext, ok := NewBackend("linkcheck", cfg).(*ExternalRenderer)
+	assert.True(t, ok)
+	assert.Equal(t, "linkcheck", ext.Name())
+
+	// Explicit command always uses the external renderer
+	_, ok = NewBackend("pdf", cfg).(*ExternalRenderer)
+	assert.True(t, ok)
+}
+
+func TestNewExternalRenderContext(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Title = "External"
+	ch := models.NewChapter("Chapter 1", "# Chapter 1", "ch1.md", nil)
+	book := models.NewBookWithItems([]models.BookItem{ch})
+
+	ctx := &RenderContext{Root: ".", DestDir: filepath.Join("book", "linkcheck"), Book: book, Config: cfg}
+	renderCtx, err := NewExternalRenderContext(ctx)
+	assert.NoError(t, err)
+
+	assert.True(t, filepath.IsAbs(renderCtx.Root))
+	assert.True(t, filepath.IsAbs(renderCtx.Destination))
+	assert.True(t, strings.HasSuffix(renderCtx.Destination, filepath.Join("book", "linkcheck")))
+	assert.Equal(t, "External", renderCtx.Config["book"].(map[string]interface{})["title"])
+	assert.Len(t, renderCtx.Book.Sections, 1)
+	assert.Equal(t, "Chapter 1", renderCtx.Book.Sections[0].Chapter.Name)
+
+	// Uses mdBook field names
+	data, err := json.Marshal(renderCtx)
+	assert.NoError(t, err)
+	for _, key := range []string{`"version"`, `"root"`, `"book"`, `"config"`, `"destination"`} {
+		assert.Contains(t, string(data), key)
+	}
+}
+
+func TestDestDirFor(t *testing.T) {
+	// A single backend renders straight into the build dir
+	assert.Equal(t, "book", DestDirFor("book", "html", []string{"html"}))
+
+	// Several backends each get their own sub-directory
+	outputs := []string{"html", "markdown"}
+	assert.Equal(t, filepath.Join("book", "html"), DestDirFor("book", "html", outputs))
+	assert.Equal(t, filepath.Join("book", "markdown"), DestDirFor("book", "markdown", outputs))
+}
+
+func TestRenderChaptersInParallel(t *testing.T) {
+	var items []models.BookItem
+	for i := 1; i <= 12; i++ {
+		items = append(items, models.NewChapter(fmt.Sprintf("Chapter %d", i), fmt.Sprintf("# Chapter %d\n\n## Part %d\n", i, i), fmt.Sprintf("ch%d.md", i), nil))
+	}
+	book := models.NewBookWithItems(items)
+
+	render := func(jobs int) string {
+		root := testutil.TempBook(t, "book")
+		out := filepath.Join(root, "book")
+		r := NewHtmlRenderer()
+		require.NoError(t, r.Render(&RenderContext{
+			Root:      root,
+			DestDir:   out,
+			Book:      book,
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Jobs:      jobs,
+		}))
+		// Every chapter is converted once and shared with the print page and search index
+		assert.Len(t, r.converted, 12)
+		return out
+	}
+
+	serial := render(1)
+	parallel := render(4)
+	for _, f := range []string{"ch1.html", "ch7.html", "ch12.html", "print.html", "searchindex.js"} {
+		assert.Equal(t, testutil.ReadFile(t, serial, f), testutil.ReadFile(t, parallel, f), f)
+	}
+	assert.Contains(t, testutil.ReadFile(t, parallel, "print.html"), `id="part-12"`)
+	assert.Contains(t, testutil.ReadFile(t, parallel, "searchindex.js"), "ch12.html#part-12")
+}
+
+func TestChapterMetadataInPage(t *testing.T) {
+	tagged := models.NewChapter("Tagged", "# Tagged", "tagged.md", nil)
+	tagged.Metadata = map[string]any{
+		"description": "All about tags",
+		"authors":     []any{"Ann", "Bob"},
+		"tags":        []any{"go", "docs"},
+	}
+	plain := models.NewChapter("Plain", "# Plain", "plain.md", nil)
+	cfg := config.NewDefaultConfig()
+	cfg.Book.Description = "The book"
+	cfg.Book.Authors = []string{"Book Author"}
+
+	root := testutil.TempBook(t, "book")
+	out := filepath.Join(root, "book")
+	require.NoError(t, NewHtmlRenderer().Render(&RenderContext{
+		Root:      root,
+		DestDir:   out,
+		Book:      models.NewBookWithItems([]models.BookItem{plain, tagged}),
+		Config:    cfg,
+		SourceDir: filepath.Join(root, "src"),
+		AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+	}))
+
+	page := testutil.ReadFile(t, out, "tagged.html")
+	assert.Contains(t, page, `<meta name="description" content="All about tags">`)
+	assert.Contains(t, page, `<meta name="author" content="Ann, Bob">`)
+	assert.Contains(t, page, `<meta name="keywords" content="go, docs">`)
+
+	page = testutil.ReadFile(t, out, "plain.html")
+	assert.Contains(t, page, `<meta name="description" content="The book">`)
+	assert.Contains(t, page, `<meta name="author" content="Book Author">`)
+	assert.NotContains(t, page, `name="keywords"`)
+}
+
+func TestTagPages(t *testing.T) {
+	intro := models.NewChapter("Intro", "# Intro", "intro.md", nil)
+	intro.Metadata = map[string]any{"tags": []any{"Go", "Docs"}, "description": "Start here"}
+	guide := models.NewChapter("Guide", "# Guide", "guide/index.md", nil)
+	guide.Metadata = map[string]any{"tags": "go"}
+	plain := models.NewChapter("Plain", "# Plain", "plain.md", nil)
+
+	render := func(cfg *config.Config) string {
+		root := testutil.TempBook(t, "book")
+		out := filepath.Join(root, "book")
+		require.NoError(t, NewHtmlRenderer().Render(&RenderContext{
+			Root:      root,
+			DestDir:   out,
+			Book:      models.NewBookWithItems([]models.BookItem{intro, guide, plain}),
+			Config:    cfg,
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+		}))
+		return out
+	}
+
+	out := render(config.NewDefaultConfig())
+	index := testutil.ReadFile(t, out, "tags/index.html")
+	assert.Contains(t, index, `<li><a href="docs.html">Docs</a> (1)</li>`)
+	// Tags differing only in case share a page, named as first seen
+	assert.Contains(t, index, `<li><a href="go.html">Go</a> (2)</li>`)
+	assert.Less(t, strings.Index(index, "docs.html"), strings.Index(index, "go.html"))
+
+	page := testutil.ReadFile(t, out, "tags/go.html")
+	assert.Contains(t, page, `<li><a href="../intro.html">Intro</a> - Start here</li>`)
+	assert.Contains(t, page, `<li><a href="../guide/index.html">Guide</a></li>`)
+	assert.Contains(t, page, `href="../css/general.css`)
+
+	assert.Contains(t, testutil.ReadFile(t, out, "intro.html"), `<a href="tags/go.html">Go</a><a href="tags/docs.html">Docs</a>`)
+	assert.Contains(t, testutil.ReadFile(t, out, "guide/index.html"), `<a href="../tags/go.html">go</a>`)
+	assert.NotContains(t, testutil.ReadFile(t, out, "plain.html"), `class="chapter-tags"`)
+
+	cfg := config.NewDefaultConfig()
+	cfg.Output["html"] = map[string]interface{}{"tag-pages": false}
+	out = render(cfg)
+	assert.NoFileExists(t, filepath.Join(out, "tags", "index.html"))
+	assert.NotContains(t, testutil.ReadFile(t, out, "intro.html"), `class="chapter-tags"`)
+}
+
+func TestTagPageSlugs(t *testing.T) {
+	a := models.NewChapter("A", "", "a.md", nil)
+	a.Metadata = map[string]any{"tags": []any{"C++", "Machine Learning"}}
+	b := models.NewChapter("B", "", "b.md", nil)
+	b.Metadata = map[string]any{"tags": []any{"C#", "C", "machine-learning", "??"}}
+	tags, slugs := collectTags([]*models.Chapter{a, b})
+	byName := map[string]string{}
+	for _, tag := range tags {
+		byName[tag.Name] = tag.Slug
+	}
+	// Tags that only slugify alike get their own pages; "C" is spelled like its slug and keeps it
+	assert.Equal(t, "c", byName["C"])
+	assert.Equal(t, "c-2", byName["C#"])
+	assert.Equal(t, "c-3", byName["C++"])
+	// Spellings of the same tag share a page
+	assert.Equal(t, "machine-learning", byName["Machine Learning"])
+	assert.NotContains(t, byName, "machine-learning")
+	assert.Regexp(t, `^tag-[0-9a-f]{8}$`, byName["??"])
+	assert.Len(t, slugs, 5)
+}
+
+func TestTagPagesCollision(t *testing.T) {
+	tagged := models.NewChapter("Intro", "# Intro", "intro.md", nil)
+	tagged.Metadata = map[string]any{"tags": "go"}
+	chapter := models.NewChapter("Go", "# Go", "tags/go.md", nil)
+
+	render := func(cfg *config.Config) (string, error) {
+		root := testutil.TempBook(t, "book")
+		out := filepath.Join(root, "book")
+		return out, NewHtmlRenderer().Render(&RenderContext{
+			Root:      root,
+			DestDir:   out,
+			Book:      models.NewBookWithItems([]models.BookItem{tagged, chapter}),
+			Config:    cfg,
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+		})
+	}
+
+	_, err := render(config.NewDefaultConfig())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tag page tags/go.html would overwrite chapter tags/go.md")
+
+	cfg := config.NewDefaultConfig()
+	cfg.Output["html"] = map[string]interface{}{"tag-dir": "topics/all"}
+	out, err := render(cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, testutil.ReadFile(t, out, "tags/go.html"), `class="tag-chapters"`)
+	page := testutil.ReadFile(t, out, "topics/all/go.html")
+	assert.Contains(t, page, `<li><a href="../../intro.html">Intro</a></li>`)
+	assert.Contains(t, testutil.ReadFile(t, out, "intro.html"), `<a href="topics/all/go.html">go</a>`)
+
+	cfg.Output["html"] = map[string]interface{}{"tag-dir": "../tags"}
+	_, err = render(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "output.html.tag-dir")
+}
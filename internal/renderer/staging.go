@@ -0,0 +1,306 @@
+package renderer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RenderAtomic renders a backend into a staging directory next to ctx.DestDir and swaps
+// it into place once rendering succeeds. A failed build leaves the previous output
+// untouched, and files the previous build produced but this one doesn't (such as pages
+// of removed chapters) disappear. Everything else in ctx.DestDir, such as a .git
+// directory or a CNAME file, is carried over. Telling geopub's files apart takes a
+// record of the previous build in ctx.Cache; a non-empty directory without one, such as
+// the output of an older geopub or of a different set of backends, is replaced as a
+// whole, with a warning. Outputs the cache finds unchanged are carried over from the
+// previous build. Backends writing anywhere but disk, or into the working directory or
+// the book itself, render in place.
+func RenderAtomic(backend Renderer, ctx *RenderContext) error {
+	dest, err := filepath.Abs(ctx.DestDir)
+	if err != nil || ctx.output() != DiskFS {
+		return backend.Render(ctx)
+	}
+	if wd, err := os.Getwd(); err != nil || pathWithin(wd, dest) {
+		return backend.Render(ctx)
+	}
+	for _, dir := range []string{ctx.Root, ctx.SourceDir} {
+		if abs, err := filepath.Abs(dir); dir != "" && (err != nil || pathWithin(abs, dest)) {
+			return backend.Render(ctx)
+		}
+	}
+
+	key := filepath.Clean(ctx.DestDir)
+	previous, known := ctx.Cache.PreviousOutputs(key)
+	overlapping := ctx.Cache.OverlappingOutputs(key)
+	if known {
+		// Outputs recorded for directories inside dest were generated too
+		for dir, files := range overlapping {
+			rel, err := filepath.Rel(key, filepath.FromSlash(dir))
+			if err != nil || !pathWithin(dir, filepath.ToSlash(key)) {
+				continue
+			}
+			for _, f := range files {
+				previous[path.Join(filepath.ToSlash(rel), f)] = true
+			}
+		}
+	} else {
+		entries, err := os.ReadDir(dest)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read output directory: %w", err)
+		}
+		if len(entries) > 0 {
+			log.Printf("Warning: %s holds no record of a previous geopub build, replacing all of its contents; later builds keep files geopub didn't generate\n", ctx.DestDir)
+		}
+	}
+
+	staging, old := stagingPaths(dest)
+	if err := os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("failed to remove stale staging directory: %w", err)
+	}
+	staged := *ctx
+	if _, ok := backend.(*ExternalRenderer); ok {
+		// External commands write wherever they are pointed
+		staged.DestDir = staging
+	} else {
+		staged.Output = &stagingFS{dest: filepath.Clean(ctx.DestDir), staging: staging}
+	}
+	if err := backend.Render(&staged); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	ctx.ResourceMap = staged.ResourceMap
+
+	outputs, err := listFiles(staging)
+	if err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to list the new output: %w", err)
+	}
+	var carried []string
+	if known {
+		if err := carryOver(dest, staging, ".", previous, outputDirs(previous), &carried); err != nil {
+			restore(dest, staging, carried)
+			os.RemoveAll(staging)
+			return fmt.Errorf("failed to carry over files geopub didn't generate: %w", err)
+		}
+	}
+	if err := swapDir(staging, old, dest); err != nil {
+		restore(dest, staging, carried)
+		os.RemoveAll(staging)
+		return err
+	}
+	ctx.Cache.SetOutputs(key, outputs)
+
+	// Outputs of a directory enclosing dest, from a build with fewer backends, are stale
+	for dir, files := range overlapping {
+		if !pathWithin(filepath.ToSlash(key), dir) {
+			ctx.Cache.ForgetOutputs(dir)
+			continue
+		}
+		if err := pruneOutputs(filepath.FromSlash(dir), key, files); err != nil {
+			return fmt.Errorf("failed to remove outputs of the previous build: %w", err)
+		}
+		ctx.Cache.ForgetOutputs(dir)
+	}
+	return nil
+}
+
+// pruneOutputs removes the files a previous build produced in dir, except those inside
+// keep, along with the directories they leave empty
+func pruneOutputs(dir, keep string, files []string) error {
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if pathWithin(filepath.ToSlash(p), filepath.ToSlash(keep)) {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for d := filepath.Dir(p); d != filepath.Clean(dir) && pathWithin(filepath.ToSlash(d), filepath.ToSlash(dir)); d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// listFiles returns every non-directory below root, relative to it and slash-separated
+func listFiles(root string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// carryOver moves the entries of dir below dest that the previous build didn't produce
+// into the same place below staging, appending what it moved to carried. Generated files
+// take precedence over files of the same name. Directories holding no previous outputs
+// (prevDirs) are moved as a whole.
+func carryOver(dest, staging, dir string, previous, prevDirs map[string]bool, carried *[]string) error {
+	entries, err := os.ReadDir(filepath.Join(dest, dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		rel := path.Join(filepath.ToSlash(dir), e.Name())
+		if previous[rel] {
+			continue
+		}
+		target := filepath.Join(staging, filepath.FromSlash(rel))
+		_, statErr := os.Lstat(target)
+		if e.IsDir() && (statErr == nil || prevDirs[rel]) {
+			if err := carryOver(dest, staging, rel, previous, prevDirs, carried); err != nil {
+				return err
+			}
+			continue
+		}
+		if statErr == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(dest, filepath.FromSlash(rel)), target); err != nil {
+			return err
+		}
+		*carried = append(*carried, rel)
+	}
+	return nil
+}
+
+// outputDirs returns every directory that holds one of the given outputs
+func outputDirs(outputs map[string]bool) map[string]bool {
+	dirs := map[string]bool{}
+	for f := range outputs {
+		for d := path.Dir(f); d != "." && !dirs[d]; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	return dirs
+}
+
+// restore moves carried entries back from staging into dest after a failed swap
+func restore(dest, staging string, carried []string) {
+	for i := len(carried) - 1; i >= 0; i-- {
+		rel := filepath.FromSlash(carried[i])
+		os.MkdirAll(filepath.Dir(filepath.Join(dest, rel)), 0755)
+		os.Rename(filepath.Join(staging, rel), filepath.Join(dest, rel))
+	}
+}
+
+// StagingDirs returns the temporary directories RenderAtomic creates next to dest
+func StagingDirs(dest string) []string {
+	staging, old := stagingPaths(dest)
+	return []string{staging, old}
+}
+
+// stagingPaths returns where the new output of dest is staged and where the previous
+// output is moved during the swap
+func stagingPaths(dest string) (staging, old string) {
+	return dest + ".staging", dest + ".old"
+}
+
+// swapDir replaces dest with staging, moving the previous output aside to old first
+func swapDir(staging, old, dest string) error {
+	if err := os.RemoveAll(old); err != nil {
+		return fmt.Errorf("failed to remove previous output: %w", err)
+	}
+	if err := os.Rename(dest, old); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move previous output aside: %w", err)
+	}
+	if err := os.Rename(staging, dest); err != nil {
+		os.Rename(old, dest)
+		return fmt.Errorf("failed to move new output into place: %w", err)
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return fmt.Errorf("failed to remove previous output: %w", err)
+	}
+	return nil
+}
+
+// stagingFS writes files meant for dest into staging instead. It starts out empty;
+// outputs that are still up to date are reused from dest when the cache asks for them.
+type stagingFS struct {
+	dest    string
+	staging string
+}
+
+// path maps a path below dest to the same path below staging
+func (s *stagingFS) path(name string) string {
+	rel, err := filepath.Rel(s.dest, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return name
+	}
+	return filepath.Join(s.staging, rel)
+}
+
+func (s *stagingFS) MkdirAll(dir string) error {
+	return os.MkdirAll(s.path(dir), 0755)
+}
+
+func (s *stagingFS) WriteFile(name string, data []byte) error {
+	return os.WriteFile(s.path(name), data, 0644)
+}
+
+func (s *stagingFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(s.path(name))
+}
+
+// Reuse carries the file name over from the previous build, preferring a hard link
+func (s *stagingFS) Reuse(name string) error {
+	target := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(name, target); err == nil {
+		return nil
+	}
+	return copyFile(name, target)
+}
+
+// copyFile copies the file src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// outputReuser is implemented by outputs that start empty and take over files that are
+// still up to date from the previous build
+type outputReuser interface {
+	Reuse(name string) error
+}
@@ -0,0 +1,170 @@
+package renderer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingRenderer writes a file and then fails
+type failingRenderer struct{}
+
+func (failingRenderer) Name() string { return "failing" }
+
+func (failingRenderer) Render(ctx *RenderContext) error {
+	if err := ctx.output().MkdirAll(ctx.DestDir); err != nil {
+		return err
+	}
+	if err := ctx.output().WriteFile(filepath.Join(ctx.DestDir, "one.html"), []byte("broken")); err != nil {
+		return err
+	}
+	return errors.New("render failed")
+}
+
+func TestRenderAtomicSwapsOutput(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	out := filepath.Join(root, "book")
+	cachePath := filepath.Join(root, ".geopub-cache", "html.json")
+
+	one := models.NewChapter("One", "# One", "one.md", nil)
+	two := models.NewChapter("Two", "# Two", "two.md", nil)
+	three := models.NewChapter("Three", "# Three", "three.md", nil)
+	newContext := func(items []models.BookItem, cache *BuildCache) *RenderContext {
+		return &RenderContext{
+			Root:      root,
+			DestDir:   out,
+			Book:      models.NewBookWithItems(items),
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Cache:     cache,
+		}
+	}
+
+	cache := LoadBuildCache(cachePath)
+	require.NoError(t, RenderAtomic(NewHtmlRenderer(), newContext([]models.BookItem{one, two, three}, cache)))
+	require.NoError(t, cache.Save())
+	assert.FileExists(t, filepath.Join(out, "three.html"))
+	first := testutil.ReadFile(t, out, "one.html")
+
+	// Removed chapters disappear and unchanged pages are carried over
+	cache = LoadBuildCache(cachePath)
+	require.NoError(t, RenderAtomic(NewHtmlRenderer(), newContext([]models.BookItem{one, two}, cache)))
+	require.NoError(t, cache.Save())
+	assert.NoFileExists(t, filepath.Join(out, "three.html"))
+	assert.Equal(t, first, testutil.ReadFile(t, out, "one.html"))
+	for _, dir := range StagingDirs(out) {
+		assert.NoDirExists(t, dir)
+	}
+
+	// A failed build leaves the previous output alone
+	err := RenderAtomic(failingRenderer{}, newContext([]models.BookItem{one}, LoadBuildCache(cachePath)))
+	assert.EqualError(t, err, "render failed")
+	assert.Equal(t, first, testutil.ReadFile(t, out, "one.html"))
+	for _, dir := range StagingDirs(out) {
+		assert.NoDirExists(t, dir)
+	}
+}
+
+func TestRenderAtomicKeepsFilesItDidNotGenerate(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	out := filepath.Join(root, "book")
+	cachePath := filepath.Join(root, ".geopub-cache", "html.json")
+
+	one := models.NewChapter("One", "# One", "one.md", nil)
+	two := models.NewChapter("Two", "# Two", "two.md", nil)
+	build := func(items ...models.BookItem) error {
+		cache := LoadBuildCache(cachePath)
+		err := RenderAtomic(NewHtmlRenderer(), &RenderContext{
+			Root:      root,
+			DestDir:   out,
+			Book:      models.NewBookWithItems(items),
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Cache:     cache,
+		})
+		if err != nil {
+			return err
+		}
+		return cache.Save()
+	}
+
+	// A directory geopub has no record of, such as the output of an older geopub, is adopted
+	testutil.WriteFile(t, out, "one.html", "stale")
+	testutil.WriteFile(t, out, "removed.html", "stale")
+	require.NoError(t, build(one, two))
+	assert.NotEqual(t, "stale", testutil.ReadFile(t, out, "one.html"))
+	assert.NoFileExists(t, filepath.Join(out, "removed.html"))
+
+	// A gh-pages worktree: files the build didn't produce survive rebuilds
+	testutil.WriteFile(t, out, filepath.Join(".git", "HEAD"), "ref: refs/heads/gh-pages")
+	testutil.WriteFile(t, out, "CNAME", "docs.example.com")
+	testutil.WriteFile(t, out, filepath.Join("css", "extra.css"), "body {}")
+	require.NoError(t, build(one))
+	assert.NoFileExists(t, filepath.Join(out, "two.html"))
+	assert.FileExists(t, filepath.Join(out, "one.html"))
+	assert.Equal(t, "ref: refs/heads/gh-pages", testutil.ReadFile(t, out, filepath.Join(".git", "HEAD")))
+	assert.Equal(t, "docs.example.com", testutil.ReadFile(t, out, "CNAME"))
+	assert.Equal(t, "body {}", testutil.ReadFile(t, out, filepath.Join("css", "extra.css")))
+
+	// Forcing a rebuild still knows which files are generated
+	cache := LoadBuildCache(cachePath)
+	cache.Invalidate()
+	require.NoError(t, cache.Save())
+	require.NoError(t, build(one))
+	assert.FileExists(t, filepath.Join(out, "CNAME"))
+}
+
+func TestRenderAtomicWritesInPlaceToMemory(t *testing.T) {
+	mem := NewMemFS()
+	ctx := &RenderContext{DestDir: "out", Output: mem}
+	assert.EqualError(t, RenderAtomic(failingRenderer{}, ctx), "render failed")
+	data, err := mem.ReadFile("out/one.html")
+	require.NoError(t, err)
+	assert.Equal(t, "broken", string(data))
+}
+
+func TestRenderAtomicSwitchesBackendLayout(t *testing.T) {
+	root := testutil.TempBook(t, "book")
+	out := filepath.Join(root, "book")
+	cachePath := filepath.Join(root, ".geopub-cache", "html.json")
+	one := models.NewChapter("One", "# One", "one.md", nil)
+	build := func(dest string) {
+		cache := LoadBuildCache(cachePath)
+		require.NoError(t, RenderAtomic(NewHtmlRenderer(), &RenderContext{
+			Root:      root,
+			DestDir:   dest,
+			Book:      models.NewBookWithItems([]models.BookItem{one}),
+			Config:    config.NewDefaultConfig(),
+			SourceDir: filepath.Join(root, "src"),
+			AssetsFS:  os.DirFS(filepath.Join("..", "..")),
+			Cache:     cache,
+		}))
+		require.NoError(t, cache.Save())
+	}
+
+	// Single backend to several: the pages of the single layout are removed from book/
+	build(DestDirFor(out, "html", []string{"html"}))
+	testutil.WriteFile(t, out, "CNAME", "docs.example.com")
+	build(DestDirFor(out, "html", []string{"html", "epub"}))
+	assert.FileExists(t, filepath.Join(out, "html", "one.html"))
+	assert.NoFileExists(t, filepath.Join(out, "one.html"))
+	assert.NoDirExists(t, filepath.Join(out, "css"))
+	assert.Equal(t, "docs.example.com", testutil.ReadFile(t, out, "CNAME"))
+
+	// Several backends to one: book/ holds other backends' directories and no record of
+	// its own, so it is replaced
+	testutil.WriteFile(t, out, filepath.Join("epub", "book.epub"), "epub")
+	build(DestDirFor(out, "html", []string{"html"}))
+	assert.FileExists(t, filepath.Join(out, "one.html"))
+	assert.NoDirExists(t, filepath.Join(out, "html"))
+	assert.NoDirExists(t, filepath.Join(out, "epub"))
+}
@@ -0,0 +1,276 @@
+package renderer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aymerick/raymond"
+	"github.com/geocine/geopub/internal/models"
+)
+
+// tagLink is a link from a chapter page to the page of one of its tags
+type tagLink struct {
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
+
+// bookTag is a tag and the chapters that carry it, in book order
+type bookTag struct {
+	Name     string
+	Slug     string
+	Chapters []*models.Chapter
+}
+
+// tagPages is where the tag pages of a build go and what they contain
+type tagPages struct {
+	dir   string            // Output directory relative to the book, with forward slashes
+	tags  []*bookTag        // Sorted by name
+	slugs map[string]string // tagKey -> file name of the tag page, without extension
+}
+
+// tagPagesEnabled reports whether tag pages are generated, set with output.html.tag-pages
+func tagPagesEnabled(ctx *RenderContext) bool {
+	return ctx.Config.GetBool("output.html.tag-pages", true)
+}
+
+// tagDir returns the output directory of the tag pages, set with output.html.tag-dir
+func tagDir(ctx *RenderContext) (string, error) {
+	setting := ctx.Config.GetString("output.html.tag-dir", "tags")
+	dir := path.Clean(strings.ReplaceAll(setting, "\\", "/"))
+	if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") || path.IsAbs(dir) {
+		return "", fmt.Errorf("output.html.tag-dir must be a directory inside the book, got %q", setting)
+	}
+	return dir, nil
+}
+
+// tagKey identifies a tag: spellings that differ only in case, or in spaces versus
+// hyphens, are the same tag
+func tagKey(tag string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(tag), func(r rune) bool {
+		return r == '-' || unicode.IsSpace(r)
+	}), "-")
+}
+
+// tagSlugBase returns the file name a tag would like for its page, without extension
+func tagSlugBase(tag string) string {
+	if slug := slugify(tag); slug != "" {
+		return slug
+	}
+	// Tags made only of symbols still need a stable name
+	return "tag-" + hashInputs(tagKey(tag))[:8]
+}
+
+// tagSlugs gives every tag key its own page name. When several tags slugify alike, such
+// as "C", "C++" and "C#", the one spelled like its slug keeps it and the others get a
+// numbered suffix in the order of their keys, so pages don't depend on chapter order.
+func tagSlugs(names map[string]string) map[string]string {
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	slugs := map[string]string{}
+	taken := map[string]bool{}
+	for _, key := range keys {
+		if base := tagSlugBase(names[key]); base == key {
+			slugs[key] = base
+			taken[base] = true
+		}
+	}
+	for _, key := range keys {
+		if _, ok := slugs[key]; ok {
+			continue
+		}
+		base := tagSlugBase(names[key])
+		slug := base
+		for n := 2; taken[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		slugs[key] = slug
+		taken[slug] = true
+	}
+	return slugs
+}
+
+// collectTags groups the chapters by the tags in their frontmatter, under the spelling
+// seen first, and names their pages. The tags are sorted by name.
+func collectTags(chapters []*models.Chapter) ([]*bookTag, map[string]string) {
+	byKey := map[string]*bookTag{}
+	names := map[string]string{}
+	var tags []*bookTag
+	for _, ch := range chapters {
+		if ch.Path == nil || ch.IsDraft {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, name := range chapterTags(ch) {
+			key := tagKey(name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			tag, ok := byKey[key]
+			if !ok {
+				tag = &bookTag{Name: name}
+				byKey[key] = tag
+				names[key] = name
+				tags = append(tags, tag)
+			}
+			tag.Chapters = append(tag.Chapters, ch)
+		}
+	}
+
+	slugs := tagSlugs(names)
+	for key, tag := range byKey {
+		tag.Slug = slugs[key]
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name)
+	})
+	return tags, slugs
+}
+
+// planTagPages collects the tags of the book before any page is written, since chapter
+// pages link to them. It fails when a tag page would overwrite a chapter or a file
+// copied from the source directory.
+func (r *HtmlRenderer) planTagPages(ctx *RenderContext) error {
+	r.tagPages = nil
+	if !tagPagesEnabled(ctx) {
+		return nil
+	}
+	dir, err := tagDir(ctx)
+	if err != nil {
+		return err
+	}
+	chapters := r.collectChapters(ctx.Book)
+	tags, slugs := collectTags(chapters)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pages := map[string]bool{dir + "/index.html": true}
+	for _, tag := range tags {
+		pages[dir+"/"+tag.Slug+".html"] = true
+	}
+	for _, ch := range chapters {
+		if ch.Path == nil {
+			continue
+		}
+		page := path.Clean(strings.ReplaceAll(strings.TrimSuffix(*ch.Path, ".md")+".html", "\\", "/"))
+		if pages[page] {
+			return fmt.Errorf("tag page %s would overwrite chapter %s; set output.html.tag-dir to put the tag pages elsewhere", page, *ch.Path)
+		}
+	}
+	if ctx.SourceDir != "" {
+		for page := range pages {
+			if _, err := os.Stat(filepath.Join(ctx.SourceDir, filepath.FromSlash(page))); err == nil {
+				return fmt.Errorf("tag page %s would overwrite the file of the same name in the source directory; set output.html.tag-dir to put the tag pages elsewhere", page)
+			}
+		}
+	}
+
+	r.tagPages = &tagPages{dir: dir, tags: tags, slugs: slugs}
+	return nil
+}
+
+// chapterTagLinks returns the links from a chapter page to its tag pages
+func (r *HtmlRenderer) chapterTagLinks(ch *models.Chapter, pathToRoot string) []tagLink {
+	if r.tagPages == nil {
+		return nil
+	}
+	var links []tagLink
+	seen := map[string]bool{}
+	for _, name := range chapterTags(ch) {
+		key := tagKey(name)
+		slug, ok := r.tagPages.slugs[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		links = append(links, tagLink{Name: name, Link: pathToRoot + r.tagPages.dir + "/" + slug + ".html"})
+	}
+	return links
+}
+
+// renderTagPages generates the index of the tag directory and a page per tag listing its
+// chapters
+func (r *HtmlRenderer) renderTagPages(ctx *RenderContext) error {
+	if r.tagPages == nil {
+		return nil
+	}
+	dir := r.tagPages.dir
+	if err := ctx.output().MkdirAll(filepath.Join(ctx.DestDir, filepath.FromSlash(dir))); err != nil {
+		return fmt.Errorf("failed to create tags directory: %w", err)
+	}
+	pathToRoot := strings.Repeat("../", strings.Count(dir, "/")+1)
+
+	var index strings.Builder
+	index.WriteString(`<h1 id="tags"><a class="header" href="#tags">Tags</a></h1>` + "\n")
+	index.WriteString(`<ul class="tag-index">` + "\n")
+	for _, tag := range r.tagPages.tags {
+		fmt.Fprintf(&index, "<li><a href=\"%s.html\">%s</a> (%d)</li>\n", tag.Slug, htmlEscape(tag.Name), len(tag.Chapters))
+	}
+	index.WriteString("</ul>\n")
+	if err := r.renderTagPage(ctx, pathToRoot, "index.html", "Tags", index.String()); err != nil {
+		return err
+	}
+
+	for _, tag := range r.tagPages.tags {
+		var page strings.Builder
+		fmt.Fprintf(&page, "<h1 id=\"%s\"><a class=\"header\" href=\"#%s\">%s</a></h1>\n", tag.Slug, tag.Slug, htmlEscape(tag.Name))
+		page.WriteString(`<ul class="tag-chapters">` + "\n")
+		for _, ch := range tag.Chapters {
+			link := pathToRoot + strings.ReplaceAll(strings.TrimSuffix(*ch.Path, ".md")+".html", "\\", "/")
+			fmt.Fprintf(&page, "<li><a href=\"%s\">%s</a>", link, htmlEscape(ch.Name))
+			if description, ok := ch.Metadata["description"].(string); ok && description != "" {
+				fmt.Fprintf(&page, " - %s", htmlEscape(description))
+			}
+			page.WriteString("</li>\n")
+		}
+		page.WriteString("</ul>\n")
+		page.WriteString(`<p><a href="index.html">All tags</a></p>` + "\n")
+		if err := r.renderTagPage(ctx, pathToRoot, tag.Slug+".html", tag.Name, page.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderTagPage renders one page of the tags directory with the page template
+func (r *HtmlRenderer) renderTagPage(ctx *RenderContext, pathToRoot, filename, title, content string) error {
+	gitUrl, _, gitIcon, gitIconClass := getGitInfo(ctx, "")
+	pd := &pageData{
+		Language:               ctx.Config.Book.Language,
+		DefaultTheme:           ctx.Config.GetString("output.html.default-theme", "light"),
+		PreferredDarkTheme:     ctx.Config.GetString("output.html.preferred-dark-theme", "navy"),
+		TextDirection:          "ltr",
+		Title:                  fmt.Sprintf("%s - %s", title, ctx.Config.Book.Title),
+		Description:            ctx.Config.Book.Description,
+		FaviconSvg:             ctx.Config.GetString("output.html.favicon-svg", "") != "",
+		FaviconPng:             ctx.Config.GetString("output.html.favicon-png", "") != "",
+		CopyFonts:              ctx.Config.GetBool("output.html.copy-fonts", true),
+		PrintEnable:            true,
+		AdditionalCSS:          ctx.Config.GetAdditionalCSS(),
+		AdditionalJS:           ctx.Config.GetAdditionalJS(),
+		SearchJS:               true,
+		SearchEnabled:          true,
+		PathToRoot:             pathToRoot,
+		BookTitle:              ctx.Config.Book.Title,
+		LiveReloadEndpoint:     ctx.LiveReloadEndpointPath,
+		Content:                raymond.SafeString(content),
+		GitRepositoryUrl:       gitUrl,
+		GitRepositoryIcon:      gitIcon,
+		GitRepositoryIconClass: gitIconClass,
+	}
+	pageHTML, err := renderPageWithHbs(ctx, pd)
+	if err != nil {
+		return fmt.Errorf("failed to render tag page %s: %w", filename, err)
+	}
+	return writeCached(ctx, filepath.Join(ctx.DestDir, filepath.FromSlash(r.tagPages.dir), filename), []byte(pageHTML))
+}
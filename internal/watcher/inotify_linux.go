@@ -0,0 +1,120 @@
+//go:build linux
+
+package watcher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotify watches directories with the Linux inotify API
+type inotify struct {
+	w    *Watcher
+	fd   int
+	file *os.File
+
+	mu      sync.Mutex
+	watches map[int32]string
+}
+
+// start watches every directory with inotify. Individually watched files are tracked
+// through their parent directory so editors that save by renaming are noticed.
+func (w *Watcher) start() (func() error, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	in := &inotify{w: w, fd: fd, file: os.NewFile(uintptr(fd), "inotify"), watches: map[int32]string{}}
+
+	for _, dir := range w.dirs {
+		w.walkDirs(dir, func(d string) { in.add(d) })
+	}
+	for f := range w.files {
+		in.add(filepath.Dir(f))
+	}
+
+	go in.read()
+	return in.file.Close, nil
+}
+
+// add starts watching a single directory
+func (in *inotify) add(dir string) {
+	wd, err := syscall.InotifyAddWatch(in.fd, dir, inotifyMask)
+	if err != nil {
+		in.w.fail(fmt.Errorf("failed to watch %s: %w", dir, err))
+		return
+	}
+	in.mu.Lock()
+	in.watches[int32(wd)] = dir
+	in.mu.Unlock()
+}
+
+// read decodes inotify events until the file is closed
+func (in *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := in.file.Read(buf)
+		if err != nil {
+			select {
+			case <-in.w.done:
+			default:
+				in.w.fail(fmt.Errorf("failed to read inotify events: %w", err))
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := string(bytes.TrimRight(buf[off+syscall.SizeofInotifyEvent:off+syscall.SizeofInotifyEvent+nameLen], "\x00"))
+			off += syscall.SizeofInotifyEvent + nameLen
+			in.handle(wd, mask, name)
+		}
+	}
+}
+
+// handle reports the file an event refers to and watches newly created directories
+func (in *inotify) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were dropped; report the watched roots so a rebuild still happens
+		for _, dir := range in.w.dirs {
+			in.w.notify(dir)
+		}
+		return
+	}
+
+	in.mu.Lock()
+	dir, ok := in.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(in.watches, wd)
+	}
+	in.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+
+	p := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && in.w.watched(p) {
+		// Files may have been written before the new directory was watched
+		in.w.walkDirs(p, func(d string) {
+			in.add(d)
+			entries, _ := os.ReadDir(d)
+			for _, e := range entries {
+				if !e.IsDir() {
+					in.w.notify(filepath.Join(d, e.Name()))
+				}
+			}
+		})
+		return
+	}
+	in.w.notify(p)
+}
@@ -0,0 +1,71 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often the tree is rescanned on platforms without inotify support
+const pollInterval = 300 * time.Millisecond
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// start falls back to periodically comparing file modification times
+func (w *Watcher) start() (func() error, error) {
+	last := w.snapshot()
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			current := w.snapshot()
+			for p, stamp := range current {
+				if prev, ok := last[p]; !ok || prev != stamp {
+					w.notify(p)
+				}
+			}
+			for p := range last {
+				if _, ok := current[p]; !ok {
+					w.notify(p)
+				}
+			}
+			last = current
+		}
+	}()
+	return func() error { return nil }, nil
+}
+
+// snapshot records the modification time and size of every watched file
+func (w *Watcher) snapshot() map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	record := func(p string) {
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			stamps[p] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	for f := range w.files {
+		record(f)
+	}
+	for _, dir := range w.dirs {
+		w.walkDirs(dir, func(d string) {
+			entries, _ := os.ReadDir(d)
+			for _, e := range entries {
+				if !e.IsDir() {
+					record(filepath.Join(d, e.Name()))
+				}
+			}
+		})
+	}
+	return stamps
+}
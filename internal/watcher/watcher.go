@@ -0,0 +1,256 @@
+// Package watcher reports changes to the files of a book so `geopub serve` can rebuild it.
+package watcher
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultIgnore lists files that never trigger a rebuild: version control metadata and
+// editor swap or backup files
+var defaultIgnore = []string{".git", "*.swp", "*~", ".#*"}
+
+// Options configures a Watcher
+type Options struct {
+	// Root is the directory that watched paths, Exclude entries, Ignore patterns and the
+	// reported changes are relative to. It defaults to the working directory.
+	Root string
+	// Ignore lists glob patterns of paths that don't trigger a rebuild. A pattern without
+	// a slash matches any path component ("*.tmp"), otherwise it matches the path relative
+	// to Root and everything below it ("src/drafts", "src/**/*.bak").
+	Ignore []string
+	// Exclude lists directories, such as the build directory, that are never watched
+	Exclude []string
+	// Debounce is how long to wait for further changes before reporting a batch
+	Debounce time.Duration
+}
+
+// Watcher reports batches of changed files below a set of watched paths
+type Watcher struct {
+	root    string
+	opts    Options
+	exclude []string
+
+	// files are watched individually; dirs are watched recursively
+	files map[string]bool
+	dirs  []string
+
+	raw     chan string
+	changes chan []string
+	errors  chan error
+	done    chan struct{}
+	once    sync.Once
+	closeFn func() error
+}
+
+// New starts watching the given files and directories. Paths that don't exist are skipped.
+func New(paths []string, opts Options) (*Watcher, error) {
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 100 * time.Millisecond
+	}
+
+	w := &Watcher{
+		root:    root,
+		opts:    opts,
+		files:   map[string]bool{},
+		raw:     make(chan string, 256),
+		changes: make(chan []string),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	for _, dir := range opts.Exclude {
+		w.exclude = append(w.exclude, w.abs(dir))
+	}
+	for _, p := range paths {
+		p = w.abs(p)
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			w.dirs = append(w.dirs, p)
+		} else {
+			w.files[p] = true
+		}
+	}
+
+	closeFn, err := w.start()
+	if err != nil {
+		return nil, err
+	}
+	w.closeFn = closeFn
+	go w.debounce()
+	return w, nil
+}
+
+// Changes delivers the sorted, slash-separated paths (relative to Options.Root) of files
+// changed since the previous batch
+func (w *Watcher) Changes() <-chan []string {
+	return w.changes
+}
+
+// Errors delivers errors that occur while watching
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.closeFn()
+	})
+	return err
+}
+
+// abs resolves p against the root
+func (w *Watcher) abs(p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(w.root, p)
+	}
+	return filepath.Clean(p)
+}
+
+// rel returns p relative to the root with forward slashes
+func (w *Watcher) rel(p string) string {
+	if r, err := filepath.Rel(w.root, p); err == nil {
+		p = r
+	}
+	return filepath.ToSlash(p)
+}
+
+// Ignored reports whether changes to p are never reported
+func (w *Watcher) Ignored(p string) bool {
+	p = w.abs(p)
+	for _, dir := range w.exclude {
+		if p == dir || strings.HasPrefix(p, dir+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	rel := w.rel(p)
+	for _, pattern := range defaultIgnore {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	for _, pattern := range w.opts.Ignore {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// watched reports whether a change to p should be reported
+func (w *Watcher) watched(p string) bool {
+	if w.files[p] {
+		return true
+	}
+	for _, dir := range w.dirs {
+		if p == dir || strings.HasPrefix(p, dir+string(os.PathSeparator)) {
+			return !w.Ignored(p)
+		}
+	}
+	return false
+}
+
+// notify queues a changed path for the next batch
+func (w *Watcher) notify(p string) {
+	if !w.watched(p) {
+		return
+	}
+	select {
+	case w.raw <- p:
+	case <-w.done:
+	}
+}
+
+// fail reports a watch error without blocking
+func (w *Watcher) fail(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// debounce groups changes that arrive within opts.Debounce of each other into one batch
+func (w *Watcher) debounce() {
+	pending := map[string]bool{}
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case p := <-w.raw:
+			pending[w.rel(p)] = true
+			timer = time.After(w.opts.Debounce)
+		case <-timer:
+			batch := make([]string, 0, len(pending))
+			for p := range pending {
+				batch = append(batch, p)
+			}
+			sort.Strings(batch)
+			pending = map[string]bool{}
+			timer = nil
+			select {
+			case w.changes <- batch:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// walkDirs calls fn for every directory below root that isn't ignored
+func (w *Watcher) walkDirs(root string, fn func(dir string)) {
+	filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if p != root && w.Ignored(p) {
+			return filepath.SkipDir
+		}
+		fn(p)
+		return nil
+	})
+}
+
+// matchGlob matches a watch-ignore pattern against a slash-separated relative path
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "/**"), "/")
+	for strings.HasPrefix(pattern, "**/") {
+		pattern = strings.TrimPrefix(pattern, "**/")
+	}
+
+	parts := strings.Split(rel, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, part := range parts {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+		return false
+	}
+	// Match the path itself or any of its parent directories
+	for i := len(parts); i > 0; i-- {
+		if ok, _ := path.Match(pattern, strings.Join(parts[:i], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.tmp", "src/notes.tmp", true},
+		{"*.tmp", "src/notes.md", false},
+		{"drafts", "src/drafts/one.md", true},
+		{"src/drafts", "src/drafts/one.md", true},
+		{"src/drafts/**", "src/drafts/a/b.md", true},
+		{"./src/*.bak", "src/x.bak", true},
+		{"src/*.bak", "src/a/x.bak", false},
+		{"**/*.bak", "src/a/x.bak", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, matchGlob(c.pattern, c.path), "%s ~ %s", c.pattern, c.path)
+	}
+}
+
+// nextChange waits for the next batch of changes
+func nextChange(t *testing.T, w *Watcher) []string {
+	t.Helper()
+	select {
+	case changed := <-w.Changes():
+		return changed
+	case err := <-w.Errors():
+		t.Fatalf("watch error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	return nil
+}
+
+func TestWatcherReportsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	require.NoError(t, os.MkdirAll(filepath.Join("src", "sub"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join("src", "out"), 0755))
+	require.NoError(t, os.WriteFile("book.toml", []byte("[book]\n"), 0644))
+	require.NoError(t, os.WriteFile("other.txt", []byte("x"), 0644))
+
+	w, err := New([]string{"book.toml", "src", "missing"}, Options{
+		Ignore:   []string{"*.tmp"},
+		Exclude:  []string{filepath.Join("src", "out")},
+		Debounce: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, os.WriteFile(filepath.Join("src", "sub", "a.md"), []byte("# A"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "b.md"), []byte("# B"), 0644))
+	assert.Equal(t, []string{"src/b.md", "src/sub/a.md"}, nextChange(t, w))
+
+	// Ignored, excluded and unwatched files don't trigger a batch
+	require.NoError(t, os.WriteFile(filepath.Join("src", "c.tmp"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "out", "index.html"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile("other.txt", []byte("y"), 0644))
+	// Files in new directories and files replaced by a rename are reported
+	require.NoError(t, os.MkdirAll(filepath.Join("src", "new"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "new", "d.md"), []byte("# D"), 0644))
+	require.NoError(t, os.WriteFile("book.toml.new", []byte("[book]\ntitle = \"T\"\n"), 0644))
+	require.NoError(t, os.Rename("book.toml.new", "book.toml"))
+	assert.Equal(t, []string{"book.toml", "src/new/d.md"}, nextChange(t, w))
+}
+
+func TestWatcherRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "book")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "src", "drafts"), 0755))
+
+	w, err := New([]string{"src"}, Options{
+		Root:     root,
+		Ignore:   []string{"src/drafts"},
+		Debounce: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer w.Close()
+
+	// Ignore patterns and reported paths are relative to the root
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "drafts", "a.md"), []byte("# A"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "b.md"), []byte("# B"), 0644))
+	assert.Equal(t, []string{"src/b.md"}, nextChange(t, w))
+}
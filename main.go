@@ -1,16 +1,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/geocine/geopub/internal/cli"
@@ -19,14 +28,17 @@ import (
 	"github.com/geocine/geopub/internal/models"
 	"github.com/geocine/geopub/internal/preprocessor/runner"
 	"github.com/geocine/geopub/internal/renderer"
+	"github.com/geocine/geopub/internal/watcher"
 )
 
 func main() {
 	// Define subcommands
 	buildCmd := flag.NewFlagSet("build", flag.ExitOnError)
 	buildDir := buildCmd.String("dest-dir", "", "Destination directory for build")
-	buildNoExternals := buildCmd.Bool("no-externals", false, "Disable external preprocessors")
+	buildNoExternals := buildCmd.Bool("no-externals", false, "Disable external preprocessors and renderers")
 	buildVerbose := buildCmd.Bool("verbose", false, "Enable verbose output")
+	buildForce := buildCmd.Bool("force", false, "Ignore the build cache and regenerate every output")
+	buildJobs := buildCmd.Int("jobs", runtime.NumCPU(), "Number of chapters to render in parallel")
 
 	initCmd := flag.NewFlagSet("init", flag.ExitOnError)
 	initName := initCmd.String("name", "", "Book directory name (or pass as positional)")
@@ -38,11 +50,18 @@ func main() {
 
 	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 	servePort := serveCmd.Int("port", 3000, "Port to serve on")
+	serveAutoPort := serveCmd.Bool("auto-port", false, "Use the next free port if -port is taken")
+	serveBasePath := serveCmd.String("base-path", "/", "URL path to serve the book under, e.g. /docs/ behind a reverse proxy")
+	serveWorkspace := serveCmd.String("workspace", "", "Serve every book (book.toml) found below this directory")
+	serveTLSCert := serveCmd.String("tls-cert", "", "TLS certificate file; serves over HTTPS together with -tls-key")
+	serveTLSKey := serveCmd.String("tls-key", "", "TLS private key file for -tls-cert")
 	serveHost := serveCmd.String("hostname", "127.0.0.1", "Hostname to bind to")
 	serveOpen := serveCmd.Bool("open", false, "Open in browser")
-	serveDest := serveCmd.String("dest-dir", "", "Destination directory for build")
-	serveNoExternals := serveCmd.Bool("no-externals", false, "Disable external preprocessors")
+	serveDest := serveCmd.String("dest-dir", "", "Write the served build to this directory instead of keeping it in memory")
+	serveNoExternals := serveCmd.Bool("no-externals", false, "Disable external preprocessors and renderers")
 	serveVerbose := serveCmd.Bool("verbose", false, "Enable verbose output")
+	serveForce := serveCmd.Bool("force", false, "Ignore the build cache for the initial build (with -dest-dir)")
+	serveJobs := serveCmd.Int("jobs", runtime.NumCPU(), "Number of chapters to render in parallel")
 
 	cleanCmd := flag.NewFlagSet("clean", flag.ExitOnError)
 	cleanDest := cleanCmd.String("dest-dir", "", "Destination directory to clean")
@@ -60,7 +79,7 @@ func main() {
 	switch os.Args[1] {
 	case "build":
 		buildCmd.Parse(os.Args[2:])
-		handleBuild(*buildDir, *buildNoExternals, *buildVerbose)
+		handleBuild(*buildDir, *buildNoExternals, *buildVerbose, *buildForce, *buildJobs)
 
 	case "init":
 		initCmd.Parse(os.Args[2:])
@@ -68,7 +87,23 @@ func main() {
 
 	case "serve":
 		serveCmd.Parse(os.Args[2:])
-		handleServe(*serveHost, *servePort, *serveOpen, *serveDest, *serveNoExternals, *serveVerbose)
+		handleServe(serveOptions{
+			host:      *serveHost,
+			port:      *servePort,
+			autoPort:  *serveAutoPort,
+			open:      *serveOpen,
+			destDir:   *serveDest,
+			basePath:  *serveBasePath,
+			workspace: *serveWorkspace,
+			tlsCert:   *serveTLSCert,
+			tlsKey:    *serveTLSKey,
+			render: renderOptions{
+				noExternals: *serveNoExternals,
+				verbose:     *serveVerbose,
+				force:       *serveForce,
+				jobs:        *serveJobs,
+			},
+		})
 
 	case "clean":
 		cleanCmd.Parse(os.Args[2:])
@@ -80,7 +115,7 @@ func main() {
 	}
 }
 
-func handleBuild(destDir string, noExternals, verbose bool) {
+func handleBuild(destDir string, noExternals, verbose, force bool, jobs int) {
 	// Load config
 	cfg, err := config.LoadFromFile("book.toml")
 	if err != nil {
@@ -121,30 +156,12 @@ func handleBuild(destDir string, noExternals, verbose bool) {
 		}
 	}
 
-	// Run preprocessors
-	fmt.Println("Running preprocessors...")
-	pipelineRunner := runner.NewRunner(cfg, "html")
-	pipelineRunner.SetVerbose(verbose)
-	pipelineRunner.SetDisableExternals(noExternals)
-
-	if err := pipelineRunner.Run(book); err != nil {
-		log.Fatalf("Failed to run preprocessors: %v", err)
-	}
-
-	// Render to HTML
+	// Run preprocessors and render every configured output
 	fmt.Printf("Rendering to: %s\n", outDir)
-	r := renderer.NewHtmlRenderer()
-	ctx := &renderer.RenderContext{
-		Root:                   ".",
-		DestDir:                outDir,
-		Book:                   book,
-		Config:                 cfg,
-		SourceDir:              filepath.Join(".", cfg.Book.Src),
-		LiveReloadEndpointPath: "", // not serving
-		AssetsFS:               embeddedFrontend,
-	}
-
-	if err := r.Render(ctx); err != nil {
+	opts := renderOptions{noExternals: noExternals, verbose: verbose, force: force, jobs: jobs}
+	_, err = renderOutputs(cfg, book, ".", outDir, opts)
+	runner.StopPersistent()
+	if err != nil {
 		log.Fatalf("Failed to render book: %v", err)
 	}
 
@@ -187,196 +204,552 @@ func handleInit(initCmd *flag.FlagSet, name, title, src, buildDir string, create
 	fmt.Println("  geopub serve     # serve locally with live reload")
 }
 
-// handleServe builds the book, serves it with live reload, and rebuilds on changes.
-func handleServe(host string, port int, open bool, destOverride string, noExternals, verbose bool) {
-	addr := fmt.Sprintf("%s:%d", host, port)
+// serveOptions are the settings of `geopub serve`
+type serveOptions struct {
+	host      string
+	port      int
+	autoPort  bool // Try the following ports if port is taken
+	open      bool
+	destDir   string // Write the served build here instead of keeping it in memory
+	basePath  string // URL path the book is served under
+	workspace string // Serve every book found below this directory
+	tlsCert   string
+	tlsKey    string
+	render    renderOptions
+}
 
-	// Load config
-	cfg, err := config.LoadFromFile("book.toml")
+// handleServe builds the book, serves it with live reload, and rebuilds on changes
+// until it is interrupted.
+func handleServe(opts serveOptions) {
+	if (opts.tlsCert == "") != (opts.tlsKey == "") {
+		log.Fatalf("-tls-cert and -tls-key must be given together")
+	}
+	scheme := "http"
+	if opts.tlsCert != "" {
+		scheme = "https"
+	}
+
+	// Claim the port before building so a taken port fails fast. Connections made
+	// during the initial build wait until the server starts.
+	ln, err := listen(opts.host, opts.port, opts.autoPort)
 	if err != nil {
-		log.Printf("Warning: could not load config file: %v. Using defaults.", err)
-		cfg = config.NewDefaultConfig()
+		log.Fatalf("Failed to listen: %v", err)
 	}
+	addr := net.JoinHostPort(opts.host, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
 
-	// Determine output directory
-	outDir := destOverride
-	if outDir == "" {
-		outDir = cfg.Build.BuildDir
+	// Pages, the live reload endpoint and the static files all live below the base path
+	basePath, err := normalizeBasePath(opts.basePath)
+	if err != nil {
+		log.Fatalf("Invalid -base-path: %v", err)
+	}
+	mux := http.NewServeMux()
+	var served []*servedBook
+	if opts.workspace != "" {
+		if opts.destDir != "" {
+			log.Fatalf("-dest-dir can't be combined with -workspace")
+		}
+		books, err := discoverBooks(opts.workspace)
+		if err != nil {
+			log.Fatalf("Failed to find books: %v", err)
+		}
+		if len(books) == 0 {
+			log.Fatalf("No book.toml found below %s", opts.workspace)
+		}
+		for _, wb := range books {
+			b := newServedBook(wb.root, "", basePath+wb.prefix, opts.render)
+			b.start()
+			b.register(mux)
+			served = append(served, b)
+		}
+		mux.Handle(basePath, workspaceIndexHandler(basePath, books))
+	} else {
+		b := newServedBook(".", opts.destDir, basePath, opts.render)
+		b.start()
+		b.register(mux)
+		served = append(served, b)
+	}
+	if basePath != "/" {
+		// Send visitors of the bare host to the book
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, basePath, http.StatusFound)
+		})
 	}
 
-	// Initial build
-	if err := buildWithOptions(outDir, true, "/__livereload", noExternals, verbose); err != nil {
-		log.Fatalf("Initial build failed: %v", err)
+	server := &http.Server{Handler: mux}
+	for _, b := range served {
+		// Live reload streams never end on their own
+		server.RegisterOnShutdown(b.broker.close)
 	}
+	url := fmt.Sprintf("%s://%s%s", scheme, addr, basePath)
 
-	// Live reload broker (SSE)
-	broker := newSSEBroker()
+	// Open browser if requested
+	if opts.open {
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			_ = openBrowser(url)
+		}()
+	}
 
-	// HTTP handlers
-	mux := http.NewServeMux()
-	// SSE endpoint
-	mux.HandleFunc("/__livereload", func(w http.ResponseWriter, r *http.Request) {
-		broker.serveSSE(w, r)
-	})
-	// Static files with 404 fallback
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Clean path and map to file in outDir
-		upath := r.URL.Path
-		if strings.HasSuffix(upath, "/") {
-			upath = upath + "index.html"
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Serving on %s\n", url)
+	serveErr := make(chan error, 1)
+	go func() {
+		if opts.tlsCert != "" {
+			serveErr <- server.ServeTLS(ln, opts.tlsCert, opts.tlsKey)
+		} else {
+			serveErr <- server.Serve(ln)
 		}
-		if upath == "/" {
-			upath = "/index.html"
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Server error: %v", err)
+	case <-ctx.Done():
+	}
+	// A second interrupt exits immediately
+	stop()
+
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down the server cleanly: %v", err)
+	}
+	for _, b := range served {
+		b.stop()
+	}
+	runner.StopPersistent()
+}
+
+// listen listens on host:port. With autoPort, the following ports are tried while
+// the port is taken.
+func listen(host string, port int, autoPort bool) (net.Listener, error) {
+	const maxPorts = 100
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err == nil || !autoPort || port == 0 {
+		return ln, err
+	}
+	for p := port + 1; p < port+maxPorts && p <= 65535; p++ {
+		if ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p))); err == nil {
+			return ln, nil
 		}
-		// Prevent path traversal
-		upath = filepath.Clean(upath)
-		target := filepath.Join(outDir, upath)
-		// Ensure target stays within outDir
-		if !strings.HasPrefix(filepath.Clean(target), filepath.Clean(outDir)) {
-			http.Error(w, "invalid path", http.StatusBadRequest)
-			return
+	}
+	return nil, fmt.Errorf("no free port found in %d-%d: %w", port, port+maxPorts-1, err)
+}
+
+// normalizeBasePath turns a --base-path value into a cleaned, URL-escaped path with
+// leading and trailing slashes, such as "/docs/". Segments may be given escaped or not.
+func normalizeBasePath(p string) (string, error) {
+	p = path.Clean("/" + strings.Trim(p, "/"))
+	if p == "/" {
+		return p, nil
+	}
+	unescaped, err := url.PathUnescape(p)
+	if err != nil {
+		return "", err
+	}
+	return escapePath(unescaped) + "/", nil
+}
+
+// escapePath escapes each segment of a slash-separated path for use in URLs and
+// ServeMux patterns, where a space would otherwise separate a method from the path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// unescapePath returns an escaped URL path as request paths (r.URL.Path) spell it
+func unescapePath(p string) string {
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		return unescaped
+	}
+	return p
+}
+
+// servedBook is a book that `geopub serve` renders, serves below its base path with
+// live reload, and rebuilds whenever its files change
+type servedBook struct {
+	root     string // Directory containing book.toml
+	basePath string
+	cfg      *config.Config
+	opts     renderOptions
+	outDir   string
+
+	// The html backend output is what gets served. It is rendered into memory, leaving the
+	// build directory untouched, unless an output directory is given.
+	siteDir string
+	site    func() fs.FS
+	build   func(force bool) ([]string, error)
+	broker  *sseBroker
+
+	watcher *watcher.Watcher
+	done    chan struct{} // Closed to stop rebuilding
+	stopped chan struct{} // Closed once no rebuild is running anymore
+}
+
+// newServedBook prepares serving the book in root below basePath. The site is kept in
+// memory unless destDir is set.
+func newServedBook(root, destDir, basePath string, opts renderOptions) *servedBook {
+	cfg, err := config.LoadFromFile(filepath.Join(root, "book.toml"))
+	if err != nil {
+		log.Printf("Warning: could not load config file: %v. Using defaults.", err)
+		cfg = config.NewDefaultConfig()
+	}
+	opts.liveReloadPath = basePath + "__livereload"
+	opts.basePath = basePath
+
+	b := &servedBook{
+		root:     root,
+		basePath: basePath,
+		cfg:      cfg,
+		opts:     opts,
+		outDir:   destDir,
+		siteDir:  ".",
+		broker:   newSSEBroker(),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	if b.outDir == "" {
+		b.outDir = filepath.Join(root, cfg.Build.BuildDir)
+	}
+	if destDir == "" {
+		mem := &memorySite{root: root}
+		b.site = mem.FS
+		b.build = func(bool) ([]string, error) {
+			return mem.build(opts)
 		}
-		if fi, err := os.Stat(target); err == nil && !fi.IsDir() {
-			http.ServeFile(w, r, target)
-			return
+	} else {
+		b.siteDir = renderer.DestDirFor(b.outDir, "html", cfg.GetOutputNames())
+		b.site = func() fs.FS { return os.DirFS(b.siteDir) }
+		b.build = func(force bool) ([]string, error) {
+			buildOpts := opts
+			buildOpts.force = force
+			return buildWithOptions(root, b.outDir, buildOpts)
 		}
-		// Fallback to 404.html
-		fourOFour := filepath.Join(outDir, "404.html")
-		if _, err := os.Stat(fourOFour); err == nil {
-			w.WriteHeader(http.StatusNotFound)
-			http.ServeFile(w, r, fourOFour)
-			return
+	}
+	return b
+}
+
+// register adds the live reload endpoint and the files of the book to mux
+func (b *servedBook) register(mux *http.ServeMux) {
+	mux.HandleFunc(b.opts.liveReloadPath, b.broker.serveSSE)
+	mux.Handle(b.basePath, http.StripPrefix(unescapePath(strings.TrimSuffix(b.basePath, "/")), http.HandlerFunc(b.serveFile)))
+}
+
+// serveFile serves a file of the site, falling back to its 404 page
+func (b *servedBook) serveFile(w http.ResponseWriter, r *http.Request) {
+	fsys := b.site()
+	// Clean path and map to a file of the site; cleaning a rooted path prevents traversal
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	if fi, err := fs.Stat(fsys, name); err == nil && !fi.IsDir() {
+		http.ServeFileFS(w, r, fsys, name)
+		return
+	}
+	// Fallback to 404.html
+	if data, err := fs.ReadFile(fsys, "404.html"); err == nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(data)
+		return
+	}
+	// Nothing has been built yet
+	if msg := b.broker.lastBuildError(); msg != "" {
+		http.Error(w, "Build failed: "+msg, http.StatusInternalServerError)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// start builds the book and keeps rebuilding it in the background when its files change.
+// A failed build is shown in the browser and fixed by the next rebuild.
+func (b *servedBook) start() {
+	if _, err := b.build(b.opts.force); err != nil {
+		log.Printf("Initial build of %s failed: %v", b.root, err)
+		b.broker.buildFailed(err)
+	}
+
+	exclude := []string{b.outDir, filepath.Join(b.root, buildCacheDir)}
+	exclude = append(exclude, renderer.StagingDirs(b.outDir)...)
+	for i, dir := range exclude {
+		// Relative to the working directory rather than the book root
+		if abs, err := filepath.Abs(dir); err == nil {
+			exclude[i] = abs
 		}
-		http.NotFound(w, r)
+	}
+	watchPaths := []string{"book.toml", b.cfg.Book.Src, "theme"}
+	watchPaths = append(watchPaths, b.cfg.Build.ExtraWatchDirs...)
+	w, err := watcher.New(watchPaths, watcher.Options{
+		Root:     b.root,
+		Ignore:   b.cfg.Build.WatchIgnore,
+		Exclude:  exclude,
+		Debounce: 150 * time.Millisecond,
 	})
+	if err != nil {
+		log.Fatalf("Failed to watch for changes: %v", err)
+	}
+	b.watcher = w
 
-	server := &http.Server{Addr: addr, Handler: mux}
-
-	// Start server
 	go func() {
-		log.Printf("Serving on http://%s\n", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+		defer close(b.stopped)
+		for {
+			select {
+			case <-b.done:
+				return
+			case changed := <-w.Changes():
+				b.rebuild(changed)
+			case err := <-w.Errors():
+				log.Printf("watch error: %v", err)
+			}
 		}
 	}()
+}
 
-	// Open browser if requested
-	if open {
-		go func() {
-			url := fmt.Sprintf("http://%s", addr)
-			time.Sleep(300 * time.Millisecond)
-			_ = openBrowser(url)
-		}()
-	}
+// stop stops watching the book, waiting for a rebuild in progress to finish
+func (b *servedBook) stop() {
+	close(b.done)
+	<-b.stopped
+	b.watcher.Close()
+}
 
-	// Watch and rebuild
-	watchPaths := []string{"book.toml", cfg.Book.Src}
-	watchPaths = append(watchPaths, cfg.Build.ExtraWatchDirs...)
-	debounce := 150 * time.Millisecond
-	var lastBuild time.Time
-	var mu sync.Mutex
+// rebuild rebuilds the book after the given files changed and tells connected browsers
+// which pages of the site were rewritten, or why the build failed.
+func (b *servedBook) rebuild(changed []string) {
+	for i, p := range changed {
+		changed[i] = filepath.Join(b.root, p)
+	}
+	log.Printf("Changed: %s", strings.Join(changed, ", "))
+	log.Println("Rebuilding...")
+	written, err := b.build(false)
+	if err != nil {
+		log.Printf("Build failed: %v", err)
+		b.broker.buildFailed(err)
+		return
+	}
+	msg, err := json.Marshal(newReloadMessage(b.siteDir, written))
+	if err != nil {
+		log.Printf("Failed to encode reload message: %v", err)
+		return
+	}
+	b.broker.buildSucceeded(string(msg))
+	log.Println("Rebuilt. Reload signal sent.")
+}
 
-	// track mtimes
-	lastHash := ""
+// reloadMessage tells live-reload clients what a rebuild changed, so pages that are
+// unaffected keep their state and stylesheet changes are applied without a reload
+type reloadMessage struct {
+	Pages []string `json:"pages"` // Rewritten HTML pages, relative to the site root
+	CSS   []string `json:"css"`   // Rewritten stylesheets, relative to the site root
+	Full  bool     `json:"full"`  // Other files changed and every page must reload
+}
 
-	for {
-		time.Sleep(300 * time.Millisecond)
-		hash, err := snapshotModHash(watchPaths)
-		if err != nil {
-			// Log and continue
-			log.Printf("watch error: %v", err)
+// newReloadMessage classifies the files a build wrote into siteDir
+func newReloadMessage(siteDir string, written []string) reloadMessage {
+	msg := reloadMessage{Pages: []string{}, CSS: []string{}}
+	for _, p := range written {
+		rel, err := filepath.Rel(siteDir, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// Written by another backend
 			continue
 		}
-		if hash != lastHash && time.Since(lastBuild) > debounce {
-			mu.Lock()
-			// Recompute within lock to avoid duplicate builds
-			hash2, _ := snapshotModHash(watchPaths)
-			if hash2 == lastHash {
-				mu.Unlock()
-				continue
-			}
-			log.Println("Change detected, rebuilding...")
-			if err := buildWithOptions(outDir, true, "/__livereload", noExternals, verbose); err != nil {
-				log.Printf("Build failed: %v", err)
-			} else {
-				lastHash = hash2
-				lastBuild = time.Now()
-				broker.broadcast("reload")
-				log.Println("Rebuilt. Reload signal sent.")
-			}
-			mu.Unlock()
+		rel = filepath.ToSlash(rel)
+		switch {
+		case strings.HasSuffix(rel, ".html"):
+			msg.Pages = append(msg.Pages, rel)
+		case strings.HasSuffix(rel, ".css"):
+			msg.CSS = append(msg.CSS, rel)
+		case rel == "searchindex.js":
+			// Picked up the next time a page loads
+		default:
+			msg.Full = true
 		}
 	}
+	return msg
 }
 
-// buildWithOptions loads the book and renders with optional live reload endpoint.
-func buildWithOptions(outDir string, serve bool, liveReloadPath string, noExternals, verbose bool) error {
-	cfg, err := config.LoadFromFile("book.toml")
+// renderOptions controls how the backends render a book
+type renderOptions struct {
+	liveReloadPath string // If non-empty, pages connect to this live reload endpoint
+	basePath       string // URL path the site is served under, "/" when empty
+	noExternals    bool
+	verbose        bool
+	force          bool // Ignore the build cache
+	jobs           int  // Chapters rendered in parallel per backend
+
+	// supports holds the preprocessor `supports` answers of the build in progress; those of
+	// persistent preprocessors are kept for the life of their process instead
+	supports *runner.SupportsCache
+}
+
+// buildWithOptions loads the book in root and renders every backend into outDir.
+// It returns the output files that were written.
+func buildWithOptions(root, outDir string, opts renderOptions) ([]string, error) {
+	cfg, book, err := loadBook(root)
+	if err != nil {
+		return nil, err
+	}
+	return renderOutputs(cfg, book, root, outDir, opts)
+}
+
+// loadBook loads the book.toml in root, falling back to defaults, and the book it describes
+func loadBook(root string) (*config.Config, *models.Book, error) {
+	cfg, err := config.LoadFromFile(filepath.Join(root, "book.toml"))
 	if err != nil {
 		cfg = config.NewDefaultConfig()
 	}
-	bl := loader.NewBookLoader(".", cfg)
+	bl := loader.NewBookLoader(root, cfg)
 	book, err := bl.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load book: %w", err)
+		return nil, nil, fmt.Errorf("failed to load book: %w", err)
 	}
+	return cfg, book, nil
+}
 
-	// Run preprocessors
-	pipelineRunner := runner.NewRunner(cfg, "html")
-	pipelineRunner.SetVerbose(verbose)
-	pipelineRunner.SetDisableExternals(noExternals)
-	if err := pipelineRunner.Run(book); err != nil {
-		return fmt.Errorf("failed to run preprocessors: %w", err)
+// buildCacheDir holds the per-backend build caches next to book.toml, outside the
+// output so it is never published along with the site
+const buildCacheDir = ".geopub-cache"
+
+// renderOutputs runs the preprocessors and renderer for every configured [output.<name>] backend
+// of the book in root.
+// Unchanged outputs are skipped using a per-backend cache under root, unless opts.force is set.
+// It returns the output files that were written, skipping the ones found unchanged.
+func renderOutputs(cfg *config.Config, book *models.Book, root, outDir string, opts renderOptions) ([]string, error) {
+	opts.supports = runner.NewSupportsCache()
+	var written []string
+	outputs := cfg.GetOutputNames()
+	for _, name := range outputs {
+		if skipExternalRenderer(cfg, name, opts) {
+			continue
+		}
+		destDir := renderer.DestDirFor(outDir, name, outputs)
+		cachePath := filepath.Join(root, buildCacheDir, name+".json")
+		cache := renderer.LoadBuildCache(cachePath)
+		if opts.force {
+			cache.Invalidate()
+		}
+		if err := renderBackend(cfg, book, root, name, destDir, opts, cache, nil); err != nil {
+			return nil, err
+		}
+		if err := cache.Save(); err != nil {
+			return nil, err
+		}
+		written = append(written, cache.Written()...)
+	}
+	return written, nil
+}
+
+// skipExternalRenderer reports whether the backend name runs an external renderer
+// command while externals are disabled, telling the user it is skipped
+func skipExternalRenderer(cfg *config.Config, name string, opts renderOptions) bool {
+	if !opts.noExternals {
+		return false
+	}
+	if _, ok := renderer.NewBackend(name, cfg).(*renderer.ExternalRenderer); !ok {
+		return false
+	}
+	fmt.Printf("Skipping renderer: %s (external disabled)\n", name)
+	return true
+}
+
+// renderBackend runs the preprocessors and renderer of one backend of the book in root into destDir, writing
+// through output (nil for disk). The backend gets its own copy of the book so preprocessor
+// mutations don't leak between backends. On disk, destDir is only replaced once the
+// backend succeeds.
+func renderBackend(cfg *config.Config, book *models.Book, root, name, destDir string, opts renderOptions, cache *renderer.BuildCache, output renderer.OutputFS) error {
+	backend := renderer.NewBackend(name, cfg)
+
+	// Run preprocessors that apply to this backend
+	backendBook := book.Clone()
+	pipelineRunner := runner.NewRunner(cfg, name)
+	pipelineRunner.SetRoot(root)
+	if opts.supports != nil {
+		pipelineRunner.SetSupportsCache(opts.supports)
+	}
+	pipelineRunner.SetVerbose(opts.verbose)
+	pipelineRunner.SetDisableExternals(opts.noExternals)
+	if err := pipelineRunner.Run(backendBook); err != nil {
+		return fmt.Errorf("failed to run preprocessors for '%s': %w", name, err)
 	}
 
-	htmlRenderer := renderer.NewHtmlRenderer()
+	if opts.verbose {
+		fmt.Printf("Rendering %s output to: %s\n", name, destDir)
+	}
 	ctx := &renderer.RenderContext{
-		Root:                   ".",
-		DestDir:                outDir,
-		Book:                   book,
+		Root:                   root,
+		DestDir:                destDir,
+		Book:                   backendBook,
 		Config:                 cfg,
-		SourceDir:              filepath.Join(".", cfg.Book.Src),
-		LiveReloadEndpointPath: "",
+		SourceDir:              filepath.Join(root, cfg.Book.Src),
+		LiveReloadEndpointPath: opts.liveReloadPath,
+		BasePath:               opts.basePath,
 		AssetsFS:               embeddedFrontend,
+		Cache:                  cache,
+		Jobs:                   opts.jobs,
+		Output:                 output,
 	}
-	if serve {
-		ctx.LiveReloadEndpointPath = liveReloadPath
-	}
-	if err := htmlRenderer.Render(ctx); err != nil {
-		return fmt.Errorf("render failed: %w", err)
+	if err := renderer.RenderAtomic(backend, ctx); err != nil {
+		return fmt.Errorf("render failed for '%s': %w", name, err)
 	}
 	return nil
 }
 
-// snapshotModHash walks provided paths and returns a coarse hash based on mtimes and sizes.
-func snapshotModHash(paths []string) (string, error) {
-	var b strings.Builder
-	for _, p := range paths {
-		info, err := os.Stat(p)
-		if err != nil {
-			// If path doesn't exist, skip
-			continue
-		}
-		if info.IsDir() {
-			filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return nil
-				}
-				if info.IsDir() {
-					return nil
-				}
-				// Ignore output dir to avoid loops
-				if strings.Contains(path, string(os.PathSeparator)+"book"+string(os.PathSeparator)) {
-					return nil
-				}
-				fmt.Fprintf(&b, "%s|%d|%d\n", path, info.ModTime().UnixNano(), info.Size())
-				return nil
-			})
-		} else {
-			fmt.Fprintf(&b, "%s|%d|%d\n", p, info.ModTime().UnixNano(), info.Size())
-		}
+// memorySite is the html output that `geopub serve` renders into memory. Each build
+// renders into a copy of the last successful one, which it replaces only once complete,
+// so requests never see a half-built site.
+type memorySite struct {
+	root string // Directory containing book.toml
+
+	mu    sync.RWMutex
+	files *renderer.MemFS
+	cache *renderer.BuildCache
+}
+
+// FS returns the files of the last successful build
+func (s *memorySite) FS() fs.FS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.files == nil {
+		return renderer.NewMemFS()
 	}
-	return b.String(), nil
+	return s.files
+}
+
+// build loads and renders the book and returns the files that changed
+func (s *memorySite) build(opts renderOptions) ([]string, error) {
+	cfg, book, err := loadBook(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	if skipExternalRenderer(cfg, "html", opts) {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	files := s.files.Clone()
+	cache := s.cache.Clone()
+	s.mu.RUnlock()
+
+	if err := renderBackend(cfg, book, s.root, "html", ".", opts, cache, files); err != nil {
+		return nil, err
+	}
+	cache.Save()
+
+	s.mu.Lock()
+	s.files, s.cache = files, cache
+	s.mu.Unlock()
+	return cache.Written(), nil
 }
 
 // openBrowser attempts to open the provided URL in a browser.
@@ -391,14 +764,30 @@ func openBrowser(url string) error {
 	}
 }
 
+// sseEvent is a named server-sent event
+type sseEvent struct {
+	name string
+	data string
+}
+
 // SSE broker for simple live reload.
 type sseBroker struct {
 	mu      sync.Mutex
-	clients map[chan string]struct{}
+	clients map[chan sseEvent]struct{}
+	// buildError is replayed to clients that connect while the last build is failing
+	buildError string
+
+	done     chan struct{} // Closed when the server shuts down
+	doneOnce sync.Once
 }
 
 func newSSEBroker() *sseBroker {
-	return &sseBroker{clients: make(map[chan string]struct{})}
+	return &sseBroker{clients: make(map[chan sseEvent]struct{}), done: make(chan struct{})}
+}
+
+// close disconnects every client so the server can shut down
+func (b *sseBroker) close() {
+	b.doneOnce.Do(func() { close(b.done) })
 }
 
 func (b *sseBroker) serveSSE(w http.ResponseWriter, r *http.Request) {
@@ -412,9 +801,12 @@ func (b *sseBroker) serveSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ch := make(chan string, 1)
+	ch := make(chan sseEvent, 4)
 	b.mu.Lock()
 	b.clients[ch] = struct{}{}
+	if b.buildError != "" {
+		ch <- buildErrorEvent(b.buildError)
+	}
 	b.mu.Unlock()
 
 	// Heartbeat to keep connection alive
@@ -437,28 +829,58 @@ func (b *sseBroker) serveSSE(w http.ResponseWriter, r *http.Request) {
 		select {
 		case <-ctx.Done():
 			return
+		case <-b.done:
+			return
 		case <-ticker.C:
 			fmt.Fprintf(w, ":hb\n\n")
 			flusher.Flush()
-		case msg := <-ch:
-			fmt.Fprintf(w, "event: reload\n")
-			fmt.Fprintf(w, "data: %s\n\n", msg)
+		case ev := <-ch:
+			fmt.Fprintf(w, "event: %s\n", ev.name)
+			fmt.Fprintf(w, "data: %s\n\n", ev.data)
 			flusher.Flush()
 		}
 	}
 }
 
-func (b *sseBroker) broadcast(msg string) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+// send delivers an event to every client without blocking; b.mu must be held
+func (b *sseBroker) send(ev sseEvent) {
 	for ch := range b.clients {
 		select {
-		case ch <- msg:
+		case ch <- ev:
 		default:
 		}
 	}
 }
 
+// buildFailed shows err as an overlay in every open page until a build succeeds
+func (b *sseBroker) buildFailed(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buildError = err.Error()
+	b.send(buildErrorEvent(b.buildError))
+}
+
+// buildErrorEvent returns the event that shows a build error overlay
+func buildErrorEvent(msg string) sseEvent {
+	data, _ := json.Marshal(map[string]string{"message": msg})
+	return sseEvent{name: "build-error", data: string(data)}
+}
+
+// buildSucceeded clears a reported build error and sends the reload message
+func (b *sseBroker) buildSucceeded(reload string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buildError = ""
+	b.send(sseEvent{name: "reload", data: reload})
+}
+
+// lastBuildError returns the message of the current build failure, if any
+func (b *sseBroker) lastBuildError() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buildError
+}
+
 func handleClean(destOverride string) {
 	// Load config
 	cfg, err := config.LoadFromFile("book.toml")
@@ -493,10 +915,13 @@ func handleClean(destOverride string) {
 		bytes += info.Size()
 		return nil
 	})
-	// Remove
+	// Remove, along with the build cache describing it
 	if err := os.RemoveAll(outDir); err != nil {
 		log.Fatalf("Failed to remove '%s': %v", outDir, err)
 	}
+	if err := os.RemoveAll(buildCacheDir); err != nil {
+		log.Fatalf("Failed to remove '%s': %v", buildCacheDir, err)
+	}
 	fmt.Printf("Removed %d files, %d directories, %s from '%s'.\n", files, dirs, humanBytes(bytes), outDir)
 }
 
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":             "/",
+		"/":            "/",
+		"docs":         "/docs/",
+		"/docs//v1/":   "/docs/v1/",
+		"/my docs/":    "/my%20docs/",
+		"/my%20docs":   "/my%20docs/",
+		"/../etc/{x}/": "/etc/%7Bx%7D/",
+	} {
+		got, err := normalizeBasePath(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := normalizeBasePath("/bad%zz")
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package plugin
+
+import "github.com/geocine/geopub/internal/models"
+
+// Book is the book being built, as laid out in SUMMARY.md
+type Book struct {
+	Items []BookItem
+}
+
+// BookItem is an entry of Book.Items or Chapter.SubItems: a *Chapter, a *Separator or a
+// *PartTitle
+type BookItem interface {
+	bookItem()
+}
+
+// Chapter is a chapter of the book
+type Chapter struct {
+	Name    string
+	Content string // Markdown, without frontmatter once the frontmatter preprocessor ran
+	// Number is the section number, such as [1 2] for 1.2; empty for unnumbered chapters
+	Number   []int
+	SubItems []BookItem
+	// Path is the chapter's file relative to the source directory; empty for drafts
+	Path string
+	// SourcePath is the chapter's file on disk
+	SourcePath  string
+	ParentNames []string
+	// Draft chapters are listed in SUMMARY.md without a file and aren't rendered
+	Draft bool
+	// Metadata is the frontmatter of the chapter, when the frontmatter preprocessor ran
+	Metadata map[string]any
+}
+
+// Separator is a separator line of the table of contents
+type Separator struct{}
+
+// PartTitle is a heading that starts a part of the book
+type PartTitle struct {
+	Title string
+}
+
+func (*Chapter) bookItem()   {}
+func (*Separator) bookItem() {}
+func (*PartTitle) bookItem() {}
+
+// Chapters returns the chapters of the book that aren't drafts, depth-first in reading order
+func (b *Book) Chapters() []*Chapter {
+	var chapters []*Chapter
+	var walk func(items []BookItem)
+	walk = func(items []BookItem) {
+		for _, item := range items {
+			if ch, ok := item.(*Chapter); ok {
+				if !ch.Draft {
+					chapters = append(chapters, ch)
+				}
+				walk(ch.SubItems)
+			}
+		}
+	}
+	walk(b.Items)
+	return chapters
+}
+
+// fromModel copies GeoPub's book model into a Book
+func fromModel(book *models.Book) *Book {
+	return &Book{Items: itemsFromModel(book.Items)}
+}
+
+func itemsFromModel(items []models.BookItem) []BookItem {
+	out := make([]BookItem, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case *models.Chapter:
+			ch := &Chapter{
+				Name:        v.Name,
+				Content:     v.Content,
+				SubItems:    itemsFromModel(v.SubItems),
+				ParentNames: v.ParentNames,
+				Draft:       v.IsDraftChapter(),
+				Metadata:    v.Metadata,
+			}
+			if v.Number != nil {
+				ch.Number = v.Number.Parts
+			}
+			if v.Path != nil {
+				ch.Path = *v.Path
+			}
+			if v.SourcePath != nil {
+				ch.SourcePath = *v.SourcePath
+			}
+			out = append(out, ch)
+		case *models.Separator:
+			out = append(out, &Separator{})
+		case *models.PartTitle:
+			out = append(out, &PartTitle{Title: v.Title})
+		}
+	}
+	return out
+}
+
+// toModel copies the items of b back into GeoPub's book model
+func (b *Book) toModel() []models.BookItem {
+	return itemsToModel(b.Items)
+}
+
+func itemsToModel(items []BookItem) []models.BookItem {
+	out := make([]models.BookItem, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Chapter:
+			ch := &models.Chapter{
+				Name:        v.Name,
+				Content:     v.Content,
+				SubItems:    itemsToModel(v.SubItems),
+				ParentNames: v.ParentNames,
+				IsDraft:     v.Draft,
+				Metadata:    v.Metadata,
+			}
+			if len(v.Number) > 0 {
+				ch.Number = &models.SectionNumber{Parts: v.Number}
+			}
+			if v.Path != "" {
+				path := v.Path
+				ch.Path = &path
+			}
+			if v.SourcePath != "" {
+				sourcePath := v.SourcePath
+				ch.SourcePath = &sourcePath
+			}
+			out = append(out, ch)
+		case *Separator:
+			out = append(out, &models.Separator{})
+		case *PartTitle:
+			out = append(out, &models.PartTitle{Title: v.Title})
+		}
+	}
+	return out
+}
@@ -0,0 +1,8 @@
+package plugin
+
+import "github.com/geocine/geopub/internal/preprocessor"
+
+// Adapt exposes the adapter Register wraps plugins in to the tests of package plugin_test
+func Adapt(p Preprocessor) preprocessor.Preprocessor {
+	return adapter{p}
+}
@@ -0,0 +1,76 @@
+// Package plugin lets a build of GeoPub run its own Go preprocessors in-process, like the
+// built-in index and frontmatter preprocessors, without the subprocess and JSON round-trip
+// of the preprocessor package.
+//
+// A plugin implements Preprocessor and registers itself from an init function:
+//
+//	package glossary
+//
+//	import "github.com/geocine/geopub/pkg/plugin"
+//
+//	type Glossary struct{}
+//
+//	func (Glossary) Name() string { return "glossary" }
+//
+//	func (Glossary) Process(book *plugin.Book) error {
+//		for _, ch := range book.Chapters() {
+//			ch.Content = expandTerms(ch.Content)
+//		}
+//		return nil
+//	}
+//
+//	func init() {
+//		plugin.Register("glossary", Glossary{})
+//	}
+//
+// The package is linked in with a blank import in the main package of the GeoPub build.
+// The book a plugin gets is a copy in this package's own types, so GeoPub's internal
+// model can change without changing this API.
+package plugin
+
+import (
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/preprocessor/runner"
+)
+
+// Preprocessor changes the book before it is rendered. Process may be called
+// concurrently when several books are built at once.
+type Preprocessor interface {
+	Name() string
+	Process(book *Book) error
+}
+
+// Register adds an in-process preprocessor. Like frontmatter, it runs for books that have
+// a [preprocessor.<name>] table, honoring its before, after and renderers settings, and
+// is never started as a command. Register panics if the name is empty or already taken.
+func Register(name string, p Preprocessor) {
+	if p == nil {
+		panic("plugin: Register needs a preprocessor")
+	}
+	runner.Register(name, adapter{p})
+}
+
+// Registered returns the names of the in-process preprocessors, including the built-in
+// ones, sorted
+func Registered() []string {
+	return runner.RegisteredPreprocessors()
+}
+
+// adapter runs a Preprocessor on GeoPub's own book model, which is free to change
+// without changing this package
+type adapter struct {
+	p Preprocessor
+}
+
+func (a adapter) Name() string {
+	return a.p.Name()
+}
+
+func (a adapter) Process(book *models.Book) error {
+	b := fromModel(book)
+	if err := a.p.Process(b); err != nil {
+		return err
+	}
+	book.Items = b.toModel()
+	return nil
+}
@@ -0,0 +1,110 @@
+package plugin_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/preprocessor/runner"
+	"github.com/geocine/geopub/pkg/plugin"
+)
+
+// shout upper-cases every chapter, using only the public book model
+type shout struct{}
+
+func (shout) Name() string { return "shout" }
+
+func (shout) Process(book *plugin.Book) error {
+	for _, ch := range book.Chapters() {
+		ch.Content = strings.ToUpper(ch.Content)
+	}
+	return nil
+}
+
+func init() {
+	plugin.Register("shout", shout{})
+}
+
+func TestRegister(t *testing.T) {
+	found := false
+	for _, name := range plugin.Registered() {
+		found = found || name == "shout"
+	}
+	if !found {
+		t.Fatalf("expected shout to be registered, got %v", plugin.Registered())
+	}
+
+	cfg, err := config.LoadFromString(`
+[book]
+title = "Test"
+
+[preprocessor.shout]
+`)
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+	book := models.NewBookWithItems([]models.BookItem{models.NewChapter("One", "quiet", "one.md", nil)})
+	if err := runner.NewRunner(cfg, "html").Run(book); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if got := book.Items[0].(*models.Chapter).Content; got != "QUIET" {
+		t.Errorf("expected the plugin to run in-process, got %q", got)
+	}
+}
+
+// recorder notes the chapters and first item of the book it was given and puts a new
+// chapter in front
+type recorder struct {
+	chapters []string
+	first    plugin.BookItem
+}
+
+func (*recorder) Name() string { return "recorder" }
+
+func (r *recorder) Process(book *plugin.Book) error {
+	for _, ch := range book.Chapters() {
+		r.chapters = append(r.chapters, ch.Name)
+	}
+	r.first = book.Items[0]
+	book.Items = append([]plugin.BookItem{&plugin.Chapter{Name: "Added", Content: "new", Path: "added.md"}}, book.Items...)
+	return nil
+}
+
+func TestBookRoundTrip(t *testing.T) {
+	child := models.NewChapter("Child", "child", "child.md", []string{"Parent"})
+	child.Number = &models.SectionNumber{Parts: []int{1, 1}}
+	parent := models.NewChapter("Parent", "parent", "parent.md", nil)
+	parent.Metadata = map[string]any{"tags": "go"}
+	parent.SubItems = []models.BookItem{child, models.NewDraftChapter("Draft", []string{"Parent"})}
+	book := models.NewBookWithItems([]models.BookItem{&models.PartTitle{Title: "Part"}, parent, &models.Separator{}})
+
+	r := &recorder{}
+	if err := plugin.Adapt(r).Process(book); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	if got := strings.Join(r.chapters, ","); got != "Parent,Child" {
+		t.Errorf("Chapters() should skip drafts, got %s", got)
+	}
+	if part, ok := r.first.(*plugin.PartTitle); !ok || part.Title != "Part" {
+		t.Errorf("expected the part title first, got %+v", r.first)
+	}
+
+	if len(book.Items) != 4 {
+		t.Fatalf("expected the added chapter and the original items, got %d", len(book.Items))
+	}
+	if added := book.Items[0].(*models.Chapter); added.Name != "Added" || added.Path == nil || *added.Path != "added.md" {
+		t.Errorf("unexpected added chapter: %+v", added)
+	}
+	got := book.Items[2].(*models.Chapter)
+	if got.Metadata["tags"] != "go" || got.SubItems[0].(*models.Chapter).Number.String() != "1.1" {
+		t.Errorf("chapter fields were lost: %+v", got)
+	}
+	if draft := got.SubItems[1].(*models.Chapter); !draft.IsDraft || draft.Path != nil {
+		t.Errorf("draft chapter was lost: %+v", draft)
+	}
+	if _, ok := book.Items[3].(*models.Separator); !ok {
+		t.Errorf("expected the separator last, got %T", book.Items[3])
+	}
+}
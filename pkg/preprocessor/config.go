@@ -0,0 +1,91 @@
+package preprocessor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Config is the [preprocessor.<name>] table of a preprocessor in book.toml
+type Config map[string]interface{}
+
+// ConfigFor returns the [preprocessor.<name>] table from the context, or an empty Config
+// when the book doesn't have one
+func ConfigFor(ctx *Context, name string) Config {
+	tables, _ := ctx.Config["preprocessor"].(map[string]interface{})
+	table, _ := tables[name].(map[string]interface{})
+	if table == nil {
+		return Config{}
+	}
+	return Config(table)
+}
+
+// Get returns the value of a key; dotted keys such as "links.check" reach into nested tables
+func (c Config) Get(key string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(c)
+	for _, part := range strings.Split(key, ".") {
+		table, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = table[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// GetString returns a string value, or defaultVal if the key is missing or not a string
+func (c Config) GetString(key string, defaultVal string) string {
+	if s, ok := c.lookup(key).(string); ok {
+		return s
+	}
+	return defaultVal
+}
+
+// GetBool returns a boolean value, or defaultVal if the key is missing or not a boolean
+func (c Config) GetBool(key string, defaultVal bool) bool {
+	if b, ok := c.lookup(key).(bool); ok {
+		return b
+	}
+	return defaultVal
+}
+
+// GetInt returns an integer value, or defaultVal if the key is missing or not a whole number
+func (c Config) GetInt(key string, defaultVal int) int {
+	switch v := c.lookup(key).(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		// Numbers arrive as float64 after the JSON round-trip
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	}
+	return defaultVal
+}
+
+// GetStringSlice returns an array of strings, or nil if the key is missing or not an array
+// Elements that aren't strings are formatted with fmt.Sprint
+func (c Config) GetStringSlice(key string) []string {
+	arr, ok := c.lookup(key).([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if s, isStr := v.(string); isStr {
+			result = append(result, s)
+		} else {
+			result = append(result, fmt.Sprint(v))
+		}
+	}
+	return result
+}
+
+// lookup returns the value of a key, or nil if it is missing
+func (c Config) lookup(key string) interface{} {
+	v, _ := c.Get(key)
+	return v
+}
@@ -0,0 +1,63 @@
+package preprocessor
+
+import "encoding/json"
+
+// PersistentEnv is set to "1" in the environment of preprocessors started in persistent
+// mode. Such a preprocessor reads one JSON request per line from stdin and answers each
+// with one line of JSON on stdout, until stdin is closed. Run handles this on its own.
+const PersistentEnv = "GEOPUB_PERSISTENT"
+
+// Context is the JSON document a preprocessor receives and returns: the book, the
+// configuration from book.toml and the renderer being built. It follows the mdBook
+// preprocessor protocol.
+type Context struct {
+	Book *Book `json:"book"`
+	// Config is book.toml as a tree of tables; see ConfigFor
+	Config map[string]interface{} `json:"config"`
+	// Renderer is the name of the backend being built, such as "html" or "epub"
+	Renderer string `json:"renderer"`
+	// Version is the version of the protocol
+	Version string `json:"version"`
+}
+
+// Book is the book in a Context
+type Book struct {
+	Sections []Section `json:"sections"`
+	// Root is the path of the book, for context
+	Root string `json:"root,omitempty"`
+}
+
+// Section is an entry of Book.Sections or Chapter.SubItems: a chapter, a separator or a
+// part title. Exactly one of its fields is set.
+type Section struct {
+	Chapter *Chapter `json:"chapter,omitempty"`
+	// IsSeparator marks a separator line of the table of contents
+	IsSeparator bool `json:"separator,omitempty"`
+	// PartTitle is a heading that starts a part of the book
+	PartTitle string `json:"part_title,omitempty"`
+}
+
+// Chapter is a chapter of the book; a chapter without Path is a draft
+type Chapter struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// Number is the section number, such as [1 2] for 1.2; empty for unnumbered chapters
+	Number   []int     `json:"number,omitempty"`
+	SubItems []Section `json:"sub_items"`
+	// Path is the chapter's file relative to the source directory
+	Path string `json:"path,omitempty"`
+	// SourcePath is the chapter's file on disk
+	SourcePath  string   `json:"source_path,omitempty"`
+	ParentNames []string `json:"parent_names"`
+	// Metadata is the frontmatter of the chapter, when the frontmatter preprocessor ran
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// decodeContext parses a context from JSON
+func decodeContext(data []byte) (*Context, error) {
+	var ctx Context
+	if err := json.Unmarshal(data, &ctx); err != nil {
+		return nil, err
+	}
+	return &ctx, nil
+}
@@ -0,0 +1,4 @@
+package preprocessor
+
+// Serve exposes serve to the tests of package preprocessor_test
+var Serve = serve
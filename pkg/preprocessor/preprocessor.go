@@ -0,0 +1,129 @@
+// Package preprocessor is the SDK for writing GeoPub preprocessors in Go.
+//
+// A preprocessor is a command that GeoPub runs before rendering. It reads the book as
+// JSON on stdin, changes it and writes it back on stdout, following the mdBook
+// preprocessor protocol. Run takes care of the protocol, including persistent mode and
+// the `supports` probe, so a preprocessor only needs to change the book:
+//
+//	package main
+//
+//	import (
+//		"log"
+//		"strings"
+//
+//		"github.com/geocine/geopub/pkg/preprocessor"
+//	)
+//
+//	func main() {
+//		err := preprocessor.Run(preprocessor.Transform(func(ctx *preprocessor.Context, ch *preprocessor.Chapter) (string, error) {
+//			author := preprocessor.ConfigFor(ctx, "author").GetString("name", "Anonymous")
+//			return strings.ReplaceAll(ch.Content, "{{AUTHOR}}", author), nil
+//		}))
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// The preprocessortest package runs a preprocessor against a book on disk in tests.
+package preprocessor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotSupported is returned by RunSupporting when GeoPub asks about a renderer the
+// preprocessor doesn't support. Exiting with a non-zero status tells GeoPub to skip it.
+var ErrNotSupported = errors.New("renderer not supported")
+
+// Run runs a preprocessor that supports every renderer: it reads the context from stdin,
+// lets process change it and writes it to stdout. When GeoPub starts the preprocessor
+// in persistent mode, Run handles one request per line until stdin is closed, reporting
+// errors of process back to GeoPub instead of returning them.
+func Run(process func(ctx *Context) error) error {
+	return RunSupporting(nil, process)
+}
+
+// RunSupporting is Run for a preprocessor that only supports some renderers. GeoPub
+// probes support with `<command> supports <renderer>`; RunSupporting answers it with
+// supports and returns ErrNotSupported when the answer is no. A nil supports answers yes.
+func RunSupporting(supports func(renderer string) bool, process func(ctx *Context) error) error {
+	if len(os.Args) > 2 && os.Args[1] == "supports" {
+		if supports != nil && !supports(os.Args[2]) {
+			return ErrNotSupported
+		}
+		return nil
+	}
+	if os.Getenv(PersistentEnv) != "1" {
+		ctx, err := ReadContext(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if err := process(ctx); err != nil {
+			return err
+		}
+		return WriteContext(os.Stdout, ctx)
+	}
+	return serve(os.Stdin, os.Stdout, process)
+}
+
+// ReadContext reads a context from r
+func ReadContext(r io.Reader) (*Context, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stdin: %w", err)
+	}
+	ctx, err := decodeContext(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal context: %w", err)
+	}
+	return ctx, nil
+}
+
+// WriteContext writes a context to w
+func WriteContext(w io.Writer, ctx *Context) error {
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal context: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write stdout: %w", err)
+	}
+	return nil
+}
+
+// serve answers the requests of persistent mode, one line each, until r is closed
+func serve(r io.Reader, w io.Writer, process func(ctx *Context) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+
+		var response interface{}
+		ctx, err := decodeContext(line)
+		if err == nil {
+			err = process(ctx)
+		}
+		if err != nil {
+			response = map[string]string{"error": err.Error()}
+		} else {
+			response = ctx
+		}
+		data, err := json.Marshal(response)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response: %w", err)
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write stdout: %w", err)
+		}
+	}
+}
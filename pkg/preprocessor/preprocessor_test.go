@@ -0,0 +1,185 @@
+package preprocessor_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/models"
+	"github.com/geocine/geopub/internal/preprocessor/runner"
+	"github.com/geocine/geopub/pkg/preprocessor"
+)
+
+// testContext returns the context GeoPub sends for a small book, after the JSON round-trip
+func testContext(t *testing.T, toml string) *preprocessor.Context {
+	t.Helper()
+	cfg, err := config.LoadFromString(toml)
+	if err != nil {
+		t.Fatalf("LoadFromString() error: %v", err)
+	}
+	child := models.NewChapter("Child", "child", "child.md", []string{"Parent"})
+	parent := models.NewChapter("Parent", "parent", "parent.md", []string{})
+	parent.SubItems = []models.BookItem{child, models.NewDraftChapter("Draft", []string{"Parent"})}
+	book := models.NewBookWithItems([]models.BookItem{
+		&models.PartTitle{Title: "Part"},
+		parent,
+		&models.Separator{},
+		models.NewChapter("Last", "last", "last.md", []string{}),
+	})
+
+	var buf bytes.Buffer
+	if err := preprocessor.WriteContext(&buf, runner.NewPreprocessorContext(book, cfg, "html")); err != nil {
+		t.Fatalf("WriteContext() error: %v", err)
+	}
+	ctx, err := preprocessor.ReadContext(&buf)
+	if err != nil {
+		t.Fatalf("ReadContext() error: %v", err)
+	}
+	return ctx
+}
+
+func TestWalkChapters(t *testing.T) {
+	ctx := testContext(t, `[book]
+title = "Test"`)
+
+	var names []string
+	preprocessor.WalkChapters(ctx.Book, func(ch *preprocessor.Chapter) error {
+		names = append(names, ch.Name)
+		return nil
+	})
+	if got := strings.Join(names, ","); got != "Parent,Child,Draft,Last" {
+		t.Errorf("unexpected walk order: %s", got)
+	}
+
+	names = nil
+	for _, ch := range preprocessor.Chapters(ctx.Book) {
+		names = append(names, ch.Name)
+	}
+	if got := strings.Join(names, ","); got != "Parent,Child,Last" {
+		t.Errorf("Chapters should skip drafts, got %s", got)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err := preprocessor.WalkChapters(ctx.Book, func(ch *preprocessor.Chapter) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("expected the walk to stop at the first error, got %v after %d chapters", err, count)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	ctx := testContext(t, `[book]
+title = "Test"`)
+
+	err := preprocessor.Transform(func(ctx *preprocessor.Context, ch *preprocessor.Chapter) (string, error) {
+		return strings.ToUpper(ch.Content), nil
+	})(ctx)
+	if err != nil {
+		t.Fatalf("Transform() error: %v", err)
+	}
+	var contents []string
+	preprocessor.WalkChapters(ctx.Book, func(ch *preprocessor.Chapter) error {
+		contents = append(contents, ch.Content)
+		return nil
+	})
+	if got := strings.Join(contents, ","); got != "PARENT,CHILD,,LAST" {
+		t.Errorf("unexpected contents: %s", got)
+	}
+
+	failed := errors.New("failed")
+	err = preprocessor.Transform(func(ctx *preprocessor.Context, ch *preprocessor.Chapter) (string, error) {
+		return "", failed
+	})(ctx)
+	if !errors.Is(err, failed) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+}
+
+func TestConfigFor(t *testing.T) {
+	ctx := testContext(t, `
+[book]
+title = "Test"
+
+[preprocessor.links]
+check = true
+depth = 3
+ratio = 0.5
+name = "links"
+ignore = ["a.md", "b.md"]
+
+[preprocessor.links.remote]
+timeout = 10
+`)
+
+	cfg := preprocessor.ConfigFor(ctx, "links")
+	if got := cfg.GetString("name", ""); got != "links" {
+		t.Errorf("GetString() = %q", got)
+	}
+	if !cfg.GetBool("check", false) {
+		t.Errorf("GetBool() = false")
+	}
+	if got := cfg.GetInt("depth", 0); got != 3 {
+		t.Errorf("GetInt() = %d", got)
+	}
+	if got := cfg.GetInt("ratio", 7); got != 7 {
+		t.Errorf("GetInt() of a fraction should return the default, got %d", got)
+	}
+	if got := cfg.GetInt("remote.timeout", 0); got != 10 {
+		t.Errorf("GetInt() of a nested key = %d", got)
+	}
+	if got := cfg.GetStringSlice("ignore"); !reflect.DeepEqual(got, []string{"a.md", "b.md"}) {
+		t.Errorf("GetStringSlice() = %v", got)
+	}
+	if got := cfg.GetString("missing", "default"); got != "default" {
+		t.Errorf("GetString() of a missing key = %q", got)
+	}
+	if got := cfg.GetString("depth.x", "default"); got != "default" {
+		t.Errorf("GetString() below a value = %q", got)
+	}
+
+	if missing := preprocessor.ConfigFor(ctx, "other"); len(missing) != 0 || missing.GetBool("check", true) != true {
+		t.Errorf("expected an empty config, got %v", missing)
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx := testContext(t, `[book]
+title = "Test"`)
+	request, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	input := string(request) + "\n" + string(request) + "\n"
+
+	calls := 0
+	var output bytes.Buffer
+	err = preprocessor.Serve(strings.NewReader(input), &output, func(ctx *preprocessor.Context) error {
+		calls++
+		if calls == 2 {
+			return errors.New("boom")
+		}
+		ctx.Book.Sections[1].Chapter.Content = "changed"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("serve() error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 responses, got %d: %s", len(lines), output.String())
+	}
+	if !strings.Contains(lines[0], `"content":"changed"`) {
+		t.Errorf("unexpected first response: %s", lines[0])
+	}
+	if lines[1] != `{"error":"boom"}` {
+		t.Errorf("unexpected second response: %s", lines[1])
+	}
+}
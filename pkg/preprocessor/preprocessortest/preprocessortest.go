@@ -0,0 +1,81 @@
+// Package preprocessortest runs GeoPub preprocessors against fixture books in tests.
+//
+//	func TestAuthor(t *testing.T) {
+//		ctx := preprocessortest.Run(t, "testdata/book", "html", process)
+//		ch := preprocessortest.Chapter(t, ctx, "intro.md")
+//		if !strings.Contains(ch.Content, "Jane") {
+//			t.Errorf("author not replaced: %s", ch.Content)
+//		}
+//	}
+package preprocessortest
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/loader"
+	"github.com/geocine/geopub/internal/preprocessor/runner"
+	"github.com/geocine/geopub/pkg/preprocessor"
+)
+
+// Context loads the book in dir, with its book.toml and SUMMARY.md, and returns the
+// context GeoPub would send to a preprocessor when building for renderer
+func Context(t testing.TB, dir, renderer string) *preprocessor.Context {
+	t.Helper()
+	cfg, err := config.LoadFromFile(filepath.Join(dir, "book.toml"))
+	if err != nil {
+		t.Fatalf("failed to load book.toml: %v", err)
+	}
+	book, err := loader.LoadBook(dir, cfg)
+	if err != nil {
+		t.Fatalf("failed to load book: %v", err)
+	}
+
+	// Go through JSON, so the preprocessor sees exactly what it would read from stdin
+	data, err := json.Marshal(runner.NewPreprocessorContext(book, cfg, renderer))
+	if err != nil {
+		t.Fatalf("failed to marshal context: %v", err)
+	}
+	ctx, err := runner.UnmarshalContext(data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal context: %v", err)
+	}
+	return ctx
+}
+
+// Run runs process against the book in dir, as Context prepares it, and returns the
+// context it produced. The result is checked to be a book GeoPub accepts back.
+func Run(t testing.TB, dir, renderer string, process func(ctx *preprocessor.Context) error) *preprocessor.Context {
+	t.Helper()
+	ctx := Context(t, dir, renderer)
+	if err := process(ctx); err != nil {
+		t.Fatalf("preprocessor failed: %v", err)
+	}
+
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		t.Fatalf("failed to marshal result: %v", err)
+	}
+	result, err := runner.UnmarshalContext(data)
+	if err != nil {
+		t.Fatalf("preprocessor returned invalid JSON: %v", err)
+	}
+	if result.Book == nil {
+		t.Fatalf("preprocessor returned no book")
+	}
+	return result
+}
+
+// Chapter returns the chapter with the given path, relative to the source directory
+func Chapter(t testing.TB, ctx *preprocessor.Context, path string) *preprocessor.Chapter {
+	t.Helper()
+	for _, ch := range preprocessor.Chapters(ctx.Book) {
+		if filepath.ToSlash(ch.Path) == path {
+			return ch
+		}
+	}
+	t.Fatalf("chapter %s not found", path)
+	return nil
+}
@@ -0,0 +1,35 @@
+package preprocessortest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/geocine/geopub/pkg/preprocessor"
+)
+
+func TestRunAgainstFixture(t *testing.T) {
+	stamp := preprocessor.Transform(func(ctx *preprocessor.Context, ch *preprocessor.Chapter) (string, error) {
+		cfg := preprocessor.ConfigFor(ctx, "stamp")
+		return ch.Content + strings.Repeat("\n"+cfg.GetString("text", ""), cfg.GetInt("count", 1)), nil
+	})
+	ctx := Run(t, "testdata/book", "html", stamp)
+
+	if ctx.Renderer != "html" {
+		t.Errorf("expected renderer html, got %q", ctx.Renderer)
+	}
+	setup := Chapter(t, ctx, "guide/setup.md")
+	if !strings.HasSuffix(setup.Content, "Install it.\n\nStamped\nStamped") {
+		t.Errorf("unexpected content: %q", setup.Content)
+	}
+	// The part title and the draft are kept
+	if got := ctx.Book.Sections[1].PartTitle; got != "Guide" {
+		t.Errorf("expected part title Guide, got %q", got)
+	}
+	draft := setup.SubItems[0].Chapter
+	if draft == nil || !preprocessor.IsDraft(draft) || draft.Content != "" {
+		t.Fatalf("expected an untouched draft, got %+v", draft)
+	}
+	if strings.Join(draft.ParentNames, ",") != "Setup" {
+		t.Errorf("expected parent names [Setup], got %v", draft.ParentNames)
+	}
+}
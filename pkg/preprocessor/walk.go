@@ -0,0 +1,65 @@
+package preprocessor
+
+// IsDraft reports whether ch is a draft chapter, which has no file and no content
+func IsDraft(ch *Chapter) bool {
+	return ch.Path == ""
+}
+
+// WalkChapters calls fn for every chapter of the book, drafts included, depth-first in
+// the order of the table of contents. It stops at the first error fn returns.
+func WalkChapters(book *Book, fn func(ch *Chapter) error) error {
+	if book == nil {
+		return nil
+	}
+	return walkSections(book.Sections, fn)
+}
+
+// walkSections calls fn for every chapter in sections and their sub-items
+func walkSections(sections []Section, fn func(ch *Chapter) error) error {
+	for _, section := range sections {
+		if section.Chapter == nil {
+			continue
+		}
+		if err := fn(section.Chapter); err != nil {
+			return err
+		}
+		if err := walkSections(section.Chapter.SubItems, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chapters returns every chapter of the book that isn't a draft, in the order of the
+// table of contents
+func Chapters(book *Book) []*Chapter {
+	var chapters []*Chapter
+	WalkChapters(book, func(ch *Chapter) error {
+		if !IsDraft(ch) {
+			chapters = append(chapters, ch)
+		}
+		return nil
+	})
+	return chapters
+}
+
+// TransformFunc returns the new content of a chapter
+type TransformFunc func(ctx *Context, ch *Chapter) (string, error)
+
+// Transform turns a per-chapter callback into a function for Run. The callback is
+// called for every chapter that isn't a draft, and its result replaces the content.
+func Transform(fn TransformFunc) func(ctx *Context) error {
+	return func(ctx *Context) error {
+		return WalkChapters(ctx.Book, func(ch *Chapter) error {
+			if IsDraft(ch) {
+				return nil
+			}
+			content, err := fn(ctx, ch)
+			if err != nil {
+				return err
+			}
+			ch.Content = content
+			return nil
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/geocine/geopub/internal/config"
+	"github.com/geocine/geopub/internal/renderer"
+)
+
+// workspaceBook is a book found by `geopub serve --workspace`
+type workspaceBook struct {
+	root   string // Directory containing book.toml
+	prefix string // Escaped URL path of the book below the base path, such as "my%20guide/"
+}
+
+// discoverBooks finds every book.toml below dir. Each book is served under its path
+// relative to dir. Hidden directories and the build directories of the books found
+// are not searched.
+func discoverBooks(dir string) ([]workspaceBook, error) {
+	books, err := findBooks(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(books) > 0 && books[0].root == dir {
+		books[0].prefix = uniquePrefix(books[0].prefix, books[1:])
+	}
+	return books, nil
+}
+
+// uniquePrefix returns prefix, or prefix with a number added when one of books already
+// uses it. Only the book at the top of the workspace can collide, as it's named after its
+// directory while the others have their own.
+func uniquePrefix(prefix string, books []workspaceBook) string {
+	taken := map[string]bool{}
+	for _, b := range books {
+		taken[b.prefix] = true
+	}
+	if !taken[prefix] {
+		return prefix
+	}
+	name := strings.TrimSuffix(prefix, "/")
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d/", name, n)
+		if !taken[candidate] {
+			log.Printf("Warning: a book in the workspace is already served at %s, serving the top-level book at %s instead\n", prefix, candidate)
+			return candidate
+		}
+	}
+}
+
+// findBooks walks dir for book.toml files, in lexical order with dir itself first
+func findBooks(dir string) ([]workspaceBook, error) {
+	var books []workspaceBook
+	skip := map[string]bool{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir && (strings.HasPrefix(d.Name(), ".") || skip[p]) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(p, "book.toml")); err != nil {
+			return nil
+		}
+
+		cfg, err := config.LoadFromFile(filepath.Join(p, "book.toml"))
+		if err != nil {
+			cfg = config.NewDefaultConfig()
+		}
+		buildDir := filepath.Join(p, cfg.Build.BuildDir)
+		skip[buildDir] = true
+		for _, staging := range renderer.StagingDirs(buildDir) {
+			skip[staging] = true
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			// A book at the top of the workspace is named after its directory
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.Base(abs)
+		}
+		books = append(books, workspaceBook{root: p, prefix: escapePath(filepath.ToSlash(rel)) + "/"})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// workspaceIndex is the landing page listing the books of a workspace
+var workspaceIndex = template.Must(template.New("workspace").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Books</title>
+</head>
+<body>
+<h1>Books</h1>
+<ul>
+{{- range .}}
+<li><a href="{{.Path}}">{{.Title}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// workspaceIndexHandler serves the landing page of a workspace at basePath
+func workspaceIndexHandler(basePath string, books []workspaceBook) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != unescapePath(basePath) {
+			http.NotFound(w, r)
+			return
+		}
+		type entry struct{ Title, Path string }
+		var entries []entry
+		for _, b := range books {
+			// Read the title on every request so renamed books show up
+			title := unescapePath(strings.TrimSuffix(b.prefix, "/"))
+			if cfg, err := config.LoadFromFile(filepath.Join(b.root, "book.toml")); err == nil && cfg.Book.Title != "" {
+				title = cfg.Book.Title
+			}
+			entries = append(entries, entry{Title: title, Path: basePath + b.prefix})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := workspaceIndex.Execute(w, entries); err != nil {
+			log.Printf("Failed to render workspace index: %v", err)
+		}
+	})
+}
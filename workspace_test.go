@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/geocine/geopub/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverBooks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docs")
+	testutil.WriteFile(t, dir, "book.toml", "[build]\nbuild-dir = \"out\"\n")
+	testutil.WriteFile(t, dir, filepath.Join("guide", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join("my book", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join("a{b}", "book.toml"), "")
+
+	// Build output, staging directories and hidden directories are not searched
+	testutil.WriteFile(t, dir, filepath.Join("out", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join("out.staging", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join("guide", "book", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join("guide", "book.old", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join(".git", "book.toml"), "")
+
+	books, err := discoverBooks(dir)
+	require.NoError(t, err)
+	var prefixes []string
+	for _, b := range books {
+		prefixes = append(prefixes, b.prefix)
+	}
+	// The top-level book is named after its directory; names are escaped for URLs
+	assert.Equal(t, []string{"docs/", "a%7Bb%7D/", "guide/", "my%20book/"}, prefixes)
+
+	// Every prefix is a valid ServeMux pattern that matches the unescaped request path
+	mux := http.NewServeMux()
+	for _, wb := range books {
+		b := &servedBook{
+			basePath: "/" + wb.prefix,
+			opts:     renderOptions{liveReloadPath: "/" + wb.prefix + "__livereload"},
+			broker:   newSSEBroker(),
+			site: func() fs.FS {
+				return fstest.MapFS{"intro.html": {Data: []byte("intro")}}
+			},
+		}
+		b.register(mux)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/my%20book/intro.html", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "intro", rec.Body.String())
+}
+
+func TestDiscoverBooksRootNameTaken(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docs")
+	testutil.WriteFile(t, dir, "book.toml", "")
+	testutil.WriteFile(t, dir, filepath.Join("docs", "book.toml"), "")
+	testutil.WriteFile(t, dir, filepath.Join("docs-2", "book.toml"), "")
+
+	books, err := discoverBooks(dir)
+	require.NoError(t, err)
+	var prefixes []string
+	for _, b := range books {
+		prefixes = append(prefixes, b.prefix)
+	}
+	// The sub-books keep their paths; the top-level book gets the first free name
+	assert.Equal(t, []string{"docs-3/", "docs/", "docs-2/"}, prefixes)
+
+	mux := http.NewServeMux()
+	assert.NotPanics(t, func() {
+		for _, wb := range books {
+			b := &servedBook{
+				basePath: "/" + wb.prefix,
+				opts:     renderOptions{liveReloadPath: "/" + wb.prefix + "__livereload"},
+				broker:   newSSEBroker(),
+			}
+			b.register(mux)
+		}
+	})
+}